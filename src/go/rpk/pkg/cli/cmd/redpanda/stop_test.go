@@ -16,6 +16,7 @@ import (
 	"bytes"
 	"fmt"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"testing"
 
@@ -69,6 +70,8 @@ func TestStopCommand(t *testing.T) {
 			require.NotNil(t, ecmd.Process)
 
 			pid := ecmd.Process.Pid
+			err = fs.MkdirAll(filepath.Dir(conf.PIDFile()), 0o755)
+			require.NoError(t, err)
 			_, err = utils.WriteBytes(
 				fs,
 				[]byte(strconv.Itoa(pid)),
@@ -11,6 +11,7 @@ package os_test
 
 import (
 	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/os"
@@ -28,6 +29,9 @@ func TestIsRunningPID(t *testing.T) {
 	defaultSetup := func(state string) beforeFunc {
 		return func(fs afero.Fs) error {
 			contents := fmt.Sprintf(fileFmt, state)
+			if err := fs.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
 			_, err := utils.WriteBytes(fs, []byte(contents), path)
 			return err
 		}
@@ -65,6 +69,9 @@ func TestIsRunningPID(t *testing.T) {
 		{
 			name: "it should fail if the file is corrupt",
 			before: func(fs afero.Fs) error {
+				if err := fs.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					return err
+				}
 				_, err := utils.WriteBytes(fs, []byte("lolwut"), path)
 				return err
 			},
@@ -202,5 +202,6 @@ func calcMd5(lines []string) string {
 }
 
 func persistGrubConfig(fs afero.Fs, grubCfg []string) {
+	fs.MkdirAll("/etc/default", 0o755)
 	utils.WriteFileLines(fs, grubCfg, "/etc/default/grub")
 }
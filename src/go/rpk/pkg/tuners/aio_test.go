@@ -11,6 +11,7 @@ package tuners_test
 
 import (
 	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/tuners"
@@ -82,6 +83,7 @@ func TestMaxAIOEventsCheck(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(st *testing.T) {
 			fs := afero.NewMemMapFs()
+			require.NoError(st, fs.MkdirAll(filepath.Dir(maxAIOEventsFile), 0o755))
 			exec := executors.NewScriptRenderingExecutor(fs, scriptPath)
 			if tt.before != nil {
 				err := tt.before(fs)
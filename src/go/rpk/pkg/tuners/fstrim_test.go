@@ -11,6 +11,7 @@ package tuners
 
 import (
 	"errors"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -70,6 +71,9 @@ func TestTuneFstrimDirectExecutorRollback(t *testing.T) {
 		if name == "redpanda-fstrim.timer" {
 			return errors.New(errMsg)
 		}
+		if err := fs.MkdirAll(filepath.Dir(systemd.UnitPath(name)), 0o755); err != nil {
+			return err
+		}
 		_, err := utils.WriteBytes(
 			fs,
 			[]byte(body),
@@ -228,6 +228,8 @@ func Test_BalanceService_BanIRQsAndRestart(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := afero.NewMemMapFs()
+			require.NoError(t, fs.MkdirAll(tt.dir, 0o755))
+			require.NoError(t, fs.MkdirAll("/proc/1", 0o755))
 			t.Log(tt.dir)
 			tt.before(fs, tt.dir, tt.configFile)
 			balanceService := NewBalanceService(
@@ -298,6 +300,7 @@ func Test_balanceService_GetBannedIRQs(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := afero.NewMemMapFs()
+			require.NoError(t, fs.MkdirAll("/etc/sysconfig", 0o755))
 			balanceService := &balanceService{
 				fs:   fs,
 				proc: &procMock{},
@@ -109,6 +109,7 @@ func Test_DeviceInfo_GetIRQs(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := afero.NewMemMapFs()
+			require.NoError(t, fs.MkdirAll("/irq_config/dev1/driver", 0o755))
 			tt.before(fs)
 			deviceInfo := NewDeviceInfo(fs, tt.procFile)
 			got, err := deviceInfo.GetIRQs(tt.irqConfigDir, tt.xenDeviceName)
@@ -68,6 +68,7 @@ PIW:          0   Posted-interrupt wakeup event
 func TestProcFile_GetIRQProcFileLinesMap(t *testing.T) {
 	// given
 	fs := afero.NewMemMapFs()
+	_ = fs.MkdirAll("/proc", 0o755)
 	_ = utils.WriteFileLines(fs, procFileLines, "/proc/interrupts")
 	procFile := NewProcFile(fs)
 	// when
@@ -11,6 +11,7 @@ package tuners_test
 
 import (
 	"fmt"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -101,6 +102,7 @@ func TestSynBacklogTuner(t *testing.T) {
 		t.Run(tt.name, func(st *testing.T) {
 			const scriptPath = "/tune.sh"
 			fs := afero.NewMemMapFs()
+			require.NoError(st, fs.MkdirAll(filepath.Dir(network.SynBacklogFile), 0o755))
 			exec := executors.NewScriptRenderingExecutor(fs, scriptPath)
 			if tt.before != nil {
 				err := tt.before(fs)
@@ -183,6 +185,7 @@ func TestListenBacklogTuner(t *testing.T) {
 		t.Run(tt.name, func(st *testing.T) {
 			const scriptPath = "/tune.sh"
 			fs := afero.NewMemMapFs()
+			require.NoError(st, fs.MkdirAll(filepath.Dir(network.ListenBacklogFile), 0o755))
 			exec := executors.NewScriptRenderingExecutor(fs, scriptPath)
 			if tt.before != nil {
 				err := tt.before(fs)
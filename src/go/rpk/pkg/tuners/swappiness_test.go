@@ -11,6 +11,7 @@ package tuners_test
 
 import (
 	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/tuners"
@@ -60,6 +61,7 @@ func TestChecker(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := afero.NewMemMapFs()
+			require.NoError(t, fs.MkdirAll(filepath.Dir(tuners.File), 0o755))
 			if tt.before != nil {
 				err := tt.before(fs)
 				require.NoError(t, err)
@@ -112,6 +114,7 @@ func TestTuner(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := afero.NewMemMapFs()
+			require.NoError(t, fs.MkdirAll(filepath.Dir(tuners.File), 0o755))
 			if tt.before != nil {
 				err := tt.before(fs)
 				require.NoError(t, err)
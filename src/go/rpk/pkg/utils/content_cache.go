@@ -0,0 +1,69 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils
+
+import (
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// ContentCache caches file contents by path. Every Read stats the file and
+// re-reads it if its size or modification time changed since it was cached.
+// Entries are keyed by path only, so a cache should only be used with a
+// single filesystem. The zero value is ready to use and safe for concurrent
+// use.
+type ContentCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedContent
+}
+
+type cachedContent struct {
+	size    int64
+	modTime time.Time
+	content []byte
+}
+
+// Read returns the contents of path, reading it from fs only if it is not
+// cached or has changed since it was cached. The returned slice is a copy
+// and may be modified by the caller.
+func (c *ContentCache) Read(fs afero.Fs, path string) ([]byte, error) {
+	info, err := fs.Stat(path)
+	if err != nil {
+		c.mu.Lock()
+		delete(c.entries, path)
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	c.mu.Lock()
+	e, ok := c.entries[path]
+	c.mu.Unlock()
+	if ok && e.size == info.Size() && e.modTime.Equal(info.ModTime()) {
+		return append([]byte(nil), e.content...), nil
+	}
+
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]cachedContent)
+	}
+	c.entries[path] = cachedContent{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		content: content,
+	}
+	c.mu.Unlock()
+	return append([]byte(nil), content...), nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentCache(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := "/etc/redpanda/redpanda.yaml"
+	require.NoError(t, afero.WriteFile(fs, path, []byte("first"), 0o644))
+	mtime := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, fs.Chtimes(path, mtime, mtime))
+
+	var c utils.ContentCache
+	bs, err := c.Read(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, "first", string(bs))
+
+	// Same size and mtime: the cached content is returned.
+	require.NoError(t, afero.WriteFile(fs, path, []byte("other"), 0o644))
+	require.NoError(t, fs.Chtimes(path, mtime, mtime))
+	bs, err = c.Read(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, "first", string(bs))
+
+	// A changed mtime invalidates the entry.
+	mtime = mtime.Add(time.Second)
+	require.NoError(t, fs.Chtimes(path, mtime, mtime))
+	bs, err = c.Read(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, "other", string(bs))
+
+	// A changed size invalidates the entry.
+	require.NoError(t, afero.WriteFile(fs, path, []byte("longer content"), 0o644))
+	require.NoError(t, fs.Chtimes(path, mtime, mtime))
+	bs, err = c.Read(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, "longer content", string(bs))
+
+	require.NoError(t, fs.Remove(path))
+	_, err = c.Read(fs, path)
+	require.Error(t, err)
+}
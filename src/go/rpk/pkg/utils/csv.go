@@ -0,0 +1,66 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/afero"
+)
+
+// ReadCSV reads all comma separated records from path.
+func ReadCSV(fs afero.Fs, path string) ([][]string, error) {
+	return ReadCSVComma(fs, path, ',')
+}
+
+// ReadCSVComma reads all records from path, using comma as the field
+// delimiter. Parse errors include the path and the 1-based record number.
+func ReadCSVComma(fs afero.Fs, path string, comma rune) ([][]string, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.Comma = comma
+	var records [][]string
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s at record %d: %w", path, len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+}
+
+// WriteCSV atomically writes records to path as comma separated values, with
+// 0o600 permissions.
+func WriteCSV(fs afero.Fs, path string, records [][]string) error {
+	return WriteCSVComma(fs, path, records, ',')
+}
+
+// WriteCSVComma is like WriteCSV, but uses comma as the field delimiter.
+func WriteCSVComma(fs afero.Fs, path string, records [][]string, comma rune) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = comma
+	if err := w.WriteAll(records); err != nil {
+		return fmt.Errorf("unable to encode records for %s: %w", path, err)
+	}
+	return writeFileAtomic(fs, path, buf.Bytes(), 0o600)
+}
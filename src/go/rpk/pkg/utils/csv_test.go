@@ -0,0 +1,50 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils_test
+
+import (
+	"encoding/csv"
+	"errors"
+	"testing"
+
+	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	records := [][]string{
+		{"topic", "description"},
+		{"foo", "has, commas"},
+		{"bar", `has "quotes"`},
+		{"baz", "has\nnewlines"},
+	}
+	require.NoError(t, utils.WriteCSV(fs, "/report.csv", records))
+	got, err := utils.ReadCSV(fs, "/report.csv")
+	require.NoError(t, err)
+	require.Equal(t, records, got)
+
+	require.NoError(t, utils.WriteCSVComma(fs, "/report.tsv", records, '\t'))
+	got, err = utils.ReadCSVComma(fs, "/report.tsv", '\t')
+	require.NoError(t, err)
+	require.Equal(t, records, got)
+}
+
+func TestReadCSVParseError(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/bad.csv", []byte("a,b\nc,\"d\n"), 0o644))
+	_, err := utils.ReadCSV(fs, "/bad.csv")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "/bad.csv")
+	require.Contains(t, err.Error(), "record 2")
+	var perr *csv.ParseError
+	require.True(t, errors.As(err, &perr))
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/afero"
+)
+
+// DiffOp is the kind of change a LineDiff describes.
+type DiffOp int
+
+const (
+	// DiffRemoved marks a line only present in the old lines.
+	DiffRemoved DiffOp = iota + 1
+	// DiffAdded marks a line only present in the new lines.
+	DiffAdded
+)
+
+// LineDiff is a single line added or removed between two versions of a file.
+type LineDiff struct {
+	Op   DiffOp
+	Line string
+	// Number is the 1-based number of the line in the old lines for
+	// removals, and in the new lines for additions.
+	Number int
+}
+
+// ErrNoBackup is returned by DiffAgainstLatestBackup when the file has no
+// backups.
+var ErrNoBackup = errors.New("no backup found")
+
+// DiffLines returns the lines removed from and added to old to get to new,
+// based on their longest common subsequence, in order of appearance; at each
+// point of change, removals come before additions. It uses memory
+// proportional to len(old)*len(new), which is fine for config files but not
+// for large logs.
+func DiffLines(old, new []string) []LineDiff {
+	// lcs[i][j] is the length of the LCS of old[i:] and new[j:].
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			switch {
+			case old[i] == new[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []LineDiff
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case i < len(old) && j < len(new) && old[i] == new[j]:
+			i++
+			j++
+		case j == len(new) || (i < len(old) && lcs[i+1][j] >= lcs[i][j+1]):
+			diff = append(diff, LineDiff{Op: DiffRemoved, Line: old[i], Number: i + 1})
+			i++
+		default:
+			diff = append(diff, LineDiff{Op: DiffAdded, Line: new[j], Number: j + 1})
+			j++
+		}
+	}
+	return diff
+}
+
+// DiffAgainstLatestBackup returns the lines changed in originalPath since its
+// newest backup made by BackupFile, as listed by ListBackups. It returns an
+// error wrapping ErrNoBackup if there is none.
+func DiffAgainstLatestBackup(fs afero.Fs, originalPath string) ([]LineDiff, error) {
+	backups, err := ListBackups(fs, originalPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(backups) == 0 {
+		return nil, fmt.Errorf("unable to diff %s: %w", originalPath, ErrNoBackup)
+	}
+	old, err := ReadFileLines(fs, backups[0])
+	if err != nil {
+		return nil, err
+	}
+	current, err := ReadFileLines(fs, originalPath)
+	if err != nil {
+		return nil, err
+	}
+	return DiffLines(old, current), nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffLines(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		old, new []string
+		exp      []utils.LineDiff
+	}{
+		{
+			name: "equal",
+			old:  []string{"a", "b"},
+			new:  []string{"a", "b"},
+		},
+		{
+			name: "changed line",
+			old:  []string{"a", "b", "c"},
+			new:  []string{"a", "B", "c", "d"},
+			exp: []utils.LineDiff{
+				{Op: utils.DiffRemoved, Line: "b", Number: 2},
+				{Op: utils.DiffAdded, Line: "B", Number: 2},
+				{Op: utils.DiffAdded, Line: "d", Number: 4},
+			},
+		},
+		{
+			name: "from empty",
+			new:  []string{"a"},
+			exp:  []utils.LineDiff{{Op: utils.DiffAdded, Line: "a", Number: 1}},
+		},
+		{
+			name: "to empty",
+			old:  []string{"a", "b"},
+			exp: []utils.LineDiff{
+				{Op: utils.DiffRemoved, Line: "a", Number: 1},
+				{Op: utils.DiffRemoved, Line: "b", Number: 2},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.exp, utils.DiffLines(test.old, test.new))
+		})
+	}
+}
+
+func TestDiffAgainstLatestBackup(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := "/etc/redpanda/redpanda.yaml"
+	require.NoError(t, afero.WriteFile(fs, path, []byte("a: 1\n"), 0o644))
+
+	_, err := utils.DiffAgainstLatestBackup(fs, path)
+	require.ErrorIs(t, err, utils.ErrNoBackup)
+
+	old, err := utils.BackupFile(fs, path)
+	require.NoError(t, err)
+	require.NoError(t, fs.Chtimes(old, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+	require.NoError(t, afero.WriteFile(fs, path, []byte("a: 1\nb: 2\n"), 0o644))
+	latest, err := utils.BackupFile(fs, path)
+	require.NoError(t, err)
+	require.NoError(t, afero.WriteFile(fs, path, []byte("b: 2\nc: 3\n"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/etc/redpanda/redpanda.yaml.vectorized.notasum.bk", nil, 0o644))
+
+	backups, err := utils.ListBackups(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, []string{latest, old}, backups)
+
+	diff, err := utils.DiffAgainstLatestBackup(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, []utils.LineDiff{
+		{Op: utils.DiffRemoved, Line: "a: 1", Number: 1},
+		{Op: utils.DiffAdded, Line: "c: 3", Number: 2},
+	}, diff)
+}
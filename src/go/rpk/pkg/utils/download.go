@@ -0,0 +1,71 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// downloadTimeout bounds the whole of a DownloadToFile request, including
+// reading the body, when the caller's context has no deadline of its own.
+const downloadTimeout = 100 * time.Second
+
+// DownloadToFile streams the body of a GET request to url into dst, which is
+// written atomically with 0o644, and returns the number of bytes written. If
+// expectedSHA256 is not empty, the SHA-256 of the body must match it, or the
+// download is discarded and an error is returned. In any failure, including
+// ctx being canceled mid-download, dst is left untouched. If ctx has no
+// deadline, the download is bounded by downloadTimeout.
+func DownloadToFile(ctx context.Context, fs afero.Fs, url, dst string, expectedSHA256 string) (int64, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, downloadTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("unable to create request for %s: %w", url, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("unable to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unable to download %s: unexpected status %s", url, resp.Status)
+	}
+
+	f, err := createAtomicFile(fs, dst, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), resp.Body)
+	if err != nil {
+		f.Abort()
+		return n, fmt.Errorf("unable to download %s to %s: %w", url, dst, err)
+	}
+	if expectedSHA256 != "" {
+		if got := hex.EncodeToString(h.Sum(nil)); got != strings.ToLower(expectedSHA256) {
+			f.Abort()
+			return n, fmt.Errorf("checksum mismatch for %s: got %s, expected %s", url, got, expectedSHA256)
+		}
+	}
+	return n, f.Commit()
+}
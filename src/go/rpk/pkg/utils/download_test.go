@@ -0,0 +1,107 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadToFile(t *testing.T) {
+	const (
+		body = "artifact"
+		sum  = "c7c5c1d70c5dec4416ab6158afd0b223ef40c29b1dc1f97ed9428b94d4cadb1c"
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/artifact" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	fs := afero.NewMemMapFs()
+	require.NoError(t, fs.MkdirAll("/opt", 0o755))
+
+	n, err := utils.DownloadToFile(ctx, fs, ts.URL+"/artifact", "/opt/artifact", sum)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(body)), n)
+	bs, err := afero.ReadFile(fs, "/opt/artifact")
+	require.NoError(t, err)
+	require.Equal(t, body, string(bs))
+
+	_, err = utils.DownloadToFile(ctx, fs, ts.URL+"/artifact", "/opt/bad", "0000")
+	require.Error(t, err)
+	exists, err := afero.Exists(fs, "/opt/bad")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	_, err = utils.DownloadToFile(ctx, fs, ts.URL+"/missing", "/opt/missing", "")
+	require.Error(t, err)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = utils.DownloadToFile(canceled, fs, ts.URL+"/artifact", "/opt/canceled", "")
+	require.ErrorIs(t, err, context.Canceled)
+
+	files, err := afero.ReadDir(fs, "/opt")
+	require.NoError(t, err)
+	require.Len(t, files, 1, "temporary files were left behind")
+}
+
+func TestDownloadToFileCanceledMidBody(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "16")
+		w.Write([]byte("partial-"))
+		w.(http.Flusher).Flush()
+		close(started)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	fs := afero.NewMemMapFs()
+	require.NoError(t, fs.MkdirAll("/opt", 0o755))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := utils.DownloadToFile(ctx, fs, ts.URL, "/opt/artifact", "")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(10 * time.Second):
+		t.Fatal("download was not canceled mid-body")
+	}
+
+	files, err := afero.ReadDir(fs, "/opt")
+	require.NoError(t, err)
+	require.Len(t, files, 0, "a partial download was left behind")
+}
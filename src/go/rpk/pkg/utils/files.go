@@ -11,76 +11,2130 @@ package utils
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/spf13/afero"
 )
 
+// maxLineSize is the longest line our line scanners accept. bufio.Scanner
+// defaults to 64KiB, which some generated config files exceed.
+const maxLineSize = 1 << 20
+
+// newLineScanner returns a line scanner over r that accepts lines up to
+// maxLineSize bytes.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return scanner
+}
+
 func ReadFileLines(fs afero.Fs, filePath string) ([]string, error) {
 	file, err := fs.Open(filePath)
 	var lines []string
 	if err != nil {
-		return nil, err
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := newLineScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// NumberedLine is a line of a file along with its 1-based line number.
+type NumberedLine struct {
+	Number int
+	Text   string
+}
+
+// ReadFileLinesNumbered is like ReadFileLines, but also returns the 1-based
+// number of each line, for use in error messages.
+func ReadFileLinesNumbered(fs afero.Fs, filePath string) ([]NumberedLine, error) {
+	file, err := fs.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []NumberedLine
+	scanner := newLineScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		lines = append(lines, NumberedLine{Number: n, Text: scanner.Text()})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// ForEachLineIndexed calls fn with each line of filePath and its 1-based line
+// number, stopping at the first error fn returns. That error is returned
+// wrapped with the line number it occurred at.
+func ForEachLineIndexed(fs afero.Fs, filePath string, fn func(lineNum int, line string) error) error {
+	file, err := fs.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := newLineScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		if err := fn(n, scanner.Text()); err != nil {
+			return fmt.Errorf("at line %d: %w", n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// ForEachLineChunk calls fn with consecutive batches of up to chunkSize lines
+// of filePath; every batch is full except possibly the last. It stops at the
+// first error fn returns. fn must not retain the slice it is given, which is
+// reused across calls.
+func ForEachLineChunk(fs afero.Fs, filePath string, chunkSize int, fn func(lines []string) error) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("invalid chunk size %d: must be positive", chunkSize)
+	}
+	file, err := fs.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	chunk := make([]string, 0, chunkSize)
+	scanner := newLineScanner(file)
+	for scanner.Scan() {
+		chunk = append(chunk, scanner.Text())
+		if len(chunk) == chunkSize {
+			if err := fn(chunk); err != nil {
+				return err
+			}
+			chunk = chunk[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(chunk) > 0 {
+		return fn(chunk)
+	}
+	return nil
+}
+
+// ReadLinesSet returns the set of lines in path, for membership checks. If trim
+// is true, surrounding whitespace is removed from each line first, and if
+// skipBlank is true, empty lines are not included.
+func ReadLinesSet(fs afero.Fs, path string, trim, skipBlank bool) (map[string]struct{}, error) {
+	lines, err := ReadFileLines(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]struct{}, len(lines))
+	for _, line := range lines {
+		if trim {
+			line = strings.TrimSpace(line)
+		}
+		if skipBlank && line == "" {
+			continue
+		}
+		set[line] = struct{}{}
+	}
+	return set, nil
+}
+
+// ReadUniqueLines returns the lines of path with duplicates removed, keeping
+// each line at the position of its first occurrence. Blank lines are treated
+// like any other line. Unlike DedupContiguousLines, it removes duplicates
+// anywhere in the file, and never modifies it.
+func ReadUniqueLines(fs afero.Fs, path string) ([]string, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	seen := make(map[string]struct{})
+	scanner := newLineScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if _, ok := seen[line]; ok {
+			continue
+		}
+		seen[line] = struct{}{}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// ReadTokens returns the whitespace separated tokens of path in file order,
+// for list files. Everything from commentPrefix to the end of a line is a
+// comment and dropped; an empty commentPrefix disables comments.
+func ReadTokens(fs afero.Fs, path, commentPrefix string) ([]string, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var tokens []string
+	scanner := newLineScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if commentPrefix != "" {
+			line, _, _ = strings.Cut(line, commentPrefix)
+		}
+		tokens = append(tokens, strings.Fields(line)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// ReadFileLinesDeadline is ReadFileLines bounded by timeout. If the read does
+// not complete in time, an error wrapping os.ErrDeadlineExceeded is returned.
+//
+// The read is performed in a goroutine that cannot be interrupted: on timeout
+// it is abandoned and lingers until the underlying read returns, if ever. This
+// is acceptable for its intended use, guarding against hung mounts.
+func ReadFileLinesDeadline(fs afero.Fs, filePath string, timeout time.Duration) ([]string, error) {
+	type result struct {
+		lines []string
+		err   error
+	}
+	done := make(chan result, 1) // Buffered so an abandoned read can exit.
+	go func() {
+		lines, err := ReadFileLines(fs, filePath)
+		done <- result{lines, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.lines, r.err
+	case <-timer.C:
+		return nil, fmt.Errorf("unable to read %s within %v: %w", filePath, timeout, os.ErrDeadlineExceeded)
+	}
+}
+
+// ReadFileLinesMax is ReadFileLines for files that must have at most maxLines
+// lines: it stops reading and errors as soon as it reaches line maxLines+1.
+// maxLines must not be negative.
+func ReadFileLinesMax(fs afero.Fs, path string, maxLines int) ([]string, error) {
+	if maxLines < 0 {
+		return nil, fmt.Errorf("invalid maximum of %d lines: must not be negative", maxLines)
+	}
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := newLineScanner(file)
+	for scanner.Scan() {
+		if len(lines) == maxLines {
+			return nil, fmt.Errorf("%s has more than the maximum of %d lines", path, maxLines)
+		}
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// ReadFileLinesUntil returns the lines of filePath that precede the first line
+// for which isStop returns true, without reading past that line. If no line
+// matches, all lines are returned.
+func ReadFileLinesUntil(fs afero.Fs, filePath string, isStop func(line string) bool) ([]string, error) {
+	file, err := fs.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := newLineScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if isStop(line) {
+			return lines, nil
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// ReadFileLinesMatching returns the lines of path that re matches. Lines are
+// filtered as they are scanned, so only matching lines are held in memory.
+func ReadFileLinesMatching(fs afero.Fs, path string, re *regexp.Regexp) ([]string, error) {
+	if re == nil {
+		return nil, errors.New("unable to filter lines: nil regular expression")
+	}
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := newLineScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); re.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// CountSubstring returns the total number of non-overlapping occurrences of
+// substr in path, as strings.Count would on each line; a line may contain
+// several. Occurrences are matched within lines, so a substr spanning a line
+// break is never found. An empty substr is an error.
+func CountSubstring(fs afero.Fs, path, substr string) (int, error) {
+	if substr == "" {
+		return 0, errors.New("unable to count occurrences of an empty string")
+	}
+	file, err := fs.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var count int
+	scanner := newLineScanner(file)
+	for scanner.Scan() {
+		count += bytes.Count(scanner.Bytes(), []byte(substr))
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ErrOffsetPastEOF is returned by ReadFileLinesFrom when the offset is beyond
+// the end of the file, as happens if the file was truncated or rotated since
+// the offset was recorded.
+var ErrOffsetPastEOF = errors.New("offset is past the end of the file")
+
+// ReadFileLinesFrom reads the complete lines of filePath starting at byte
+// offset, and returns them along with the offset just past the last complete
+// line. A trailing line without a newline is not consumed, so calling again
+// with newOffset resumes exactly where the previous call stopped, as in tail
+// -f. If offset is past the end of the file, an error wrapping
+// ErrOffsetPastEOF is returned, and the caller should resume from 0.
+func ReadFileLinesFrom(fs afero.Fs, filePath string, offset int64) (lines []string, newOffset int64, err error) {
+	file, err := fs.Open(filePath)
+	if err != nil {
+		return nil, offset, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, offset, err
+	}
+	if offset > info.Size() {
+		return nil, offset, fmt.Errorf("%w: %d is past %d bytes of %s", ErrOffsetPastEOF, offset, info.Size(), filePath)
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, fmt.Errorf("unable to seek to %d in %s: %v", offset, filePath, err)
+	}
+	newOffset = offset
+	r := bufio.NewReader(file)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return lines, newOffset, nil
+			}
+			return nil, offset, fmt.Errorf("unable to read %s: %v", filePath, err)
+		}
+		newOffset += int64(len(line))
+		line = strings.TrimSuffix(line, "\n")
+		lines = append(lines, strings.TrimSuffix(line, "\r"))
+	}
+}
+
+// PreviewFile returns the first headLines and last tailLines lines of path, and
+// how many lines between them were omitted. The head is read forward and the
+// tail backward from the end of the file; the omitted lines are only counted,
+// never held in memory. If head and tail together cover the file, no line is
+// returned twice and omitted is 0.
+func PreviewFile(fs afero.Fs, path string, headLines, tailLines int) (head []string, tail []string, omitted int, err error) {
+	if headLines < 0 || tailLines < 0 {
+		return nil, nil, 0, fmt.Errorf("invalid preview of %d head and %d tail lines", headLines, tailLines)
+	}
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	size := info.Size()
+
+	var headEnd int64
+	r := bufio.NewReader(file)
+	for len(head) < headLines {
+		raw, err := r.ReadString('\n')
+		if raw != "" {
+			headEnd += int64(len(raw))
+			head = append(head, strings.TrimSuffix(strings.TrimSuffix(raw, "\n"), "\r"))
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	tailStart, err := tailOffset(file, size, tailLines)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if tailStart < headEnd {
+		tailStart = headEnd
+	}
+	if tailStart < size {
+		scanner := newLineScanner(io.NewSectionReader(file, tailStart, size-tailStart))
+		for scanner.Scan() {
+			tail = append(tail, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	// tailStart is at the start of a line, or at EOF when there is no
+	// tail, in which case the middle may end with an unterminated line.
+	omitted, last, err := countNewlines(io.NewSectionReader(file, headEnd, tailStart-headEnd))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if tailStart > headEnd && last != '\n' {
+		omitted++
+	}
+	return head, tail, omitted, nil
+}
+
+// tailOffset returns the offset at which the last n lines of the size bytes
+// in r start, reading backward from the end in fixed-size blocks.
+func tailOffset(r io.ReaderAt, size int64, n int) (int64, error) {
+	if n == 0 {
+		return size, nil
+	}
+	const blockSize = 4096
+	buf := make([]byte, blockSize)
+	end := size
+	// A newline ending the final line does not start a new one.
+	skipLast := true
+	for end > 0 {
+		start := end - blockSize
+		if start < 0 {
+			start = 0
+		}
+		block := buf[:end-start]
+		if _, err := r.ReadAt(block, start); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		for i := len(block) - 1; i >= 0; i-- {
+			if block[i] != '\n' {
+				continue
+			}
+			if skipLast && start+int64(i) == size-1 {
+				continue
+			}
+			if n--; n == 0 {
+				return start + int64(i) + 1, nil
+			}
+		}
+		skipLast = false
+		end = start
+	}
+	return 0, nil
+}
+
+// TrimToLastLines keeps only the last n lines of path, locating them by
+// reading backward from the end as PreviewFile does, and returns how many lines
+// were removed. If n <= 0 the file is emptied. The file is rewritten
+// atomically, preserving its mode, and only if there is anything to remove.
+func TrimToLastLines(fs afero.Fs, path string, n int) (int, error) {
+	if n < 0 {
+		n = 0
+	}
+	file, err := fs.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	start, err := tailOffset(file, size, n)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	if start == 0 {
+		return 0, nil
+	}
+
+	// start is just past a newline, unless n is 0 and the file does not
+	// end with one, in which case the unterminated last line is removed too.
+	removed, last, err := countNewlines(io.NewSectionReader(file, 0, start))
+	if err != nil {
+		return 0, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	if last != '\n' {
+		removed++
+	}
+	kept := make([]byte, size-start)
+	if _, err := file.ReadAt(kept, start); err != nil && !errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	if err := writeFileAtomic(fs, path, kept, info.Mode().Perm()); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// countNewlines returns the number of newlines in r and the last byte read.
+func countNewlines(r io.Reader) (count int, last byte, err error) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			count += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if errors.Is(err, io.EOF) {
+			return count, last, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+// LinesDiffCount returns how many lines would be added and removed if the
+// content of path were replaced with lines, based on the longest common
+// subsequence of the two. If path does not exist, every line is an addition.
+// Unlike DiffLines, only the length of the subsequence is computed, in memory
+// proportional to len(lines), so it is fine for large files.
+func LinesDiffCount(fs afero.Fs, path string, lines []string) (added, removed int, err error) {
+	current, err := ReadFileLines(fs, path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, 0, err
+	}
+	common := lcsLen(current, lines)
+	return len(lines) - common, len(current) - common, nil
+}
+
+// lcsLen returns the length of the longest common subsequence of a and b.
+func lcsLen(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] >= cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// NormalizeLineEndings rewrites path so that every line terminator, whether
+// LF, CRLF or a lone CR, is eol, which must be "\n" or "\r\n". It returns
+// whether anything changed; the file is only rewritten if so, atomically and
+// preserving its mode. A final line without a terminator is left without one.
+func NormalizeLineEndings(fs afero.Fs, path string, eol string) (bool, error) {
+	if eol != "\n" && eol != "\r\n" {
+		return false, fmt.Errorf("invalid line ending %q: must be \"\\n\" or \"\\r\\n\"", eol)
+	}
+	info, err := fs.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return false, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	normalized := make([]byte, 0, len(content))
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; {
+		case c == '\r' && i+1 < len(content) && content[i+1] == '\n':
+			normalized = append(normalized, eol...)
+			i++
+		case c == '\r' || c == '\n':
+			normalized = append(normalized, eol...)
+		default:
+			normalized = append(normalized, c)
+		}
+	}
+	if bytes.Equal(content, normalized) {
+		return false, nil
+	}
+	return true, writeFileAtomic(fs, path, normalized, info.Mode().Perm())
+}
+
+// DedupContiguousLines collapses runs of identical adjacent lines in path down
+// to a single line, like uniq, and returns how many lines were removed.
+// Duplicates that are not adjacent are kept. The file is rewritten atomically,
+// preserving its mode, and only if any line was removed.
+func DedupContiguousLines(fs afero.Fs, path string) (int, error) {
+	lines, err := ReadFileLines(fs, path)
+	if err != nil {
+		return 0, err
+	}
+	var deduped []string
+	for i, line := range lines {
+		if i > 0 && line == lines[i-1] {
+			continue
+		}
+		deduped = append(deduped, line)
+	}
+	removed := len(lines) - len(deduped)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, rewriteFileLines(fs, path, deduped)
+}
+
+// ReadLogicalLines is like ReadFileLines, but joins physical lines ending in a
+// backslash with the line that follows, dropping the backslash and the
+// newline. A line ending in an escaped backslash (an even number of trailing
+// backslashes) is not joined. A continuation on the last line of the file is
+// dropped.
+func ReadLogicalLines(fs afero.Fs, path string) ([]string, error) {
+	physical, err := ReadFileLines(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		lines   []string
+		current strings.Builder
+		pending bool
+	)
+	for _, line := range physical {
+		trailing := len(line) - len(strings.TrimRight(line, `\`))
+		if trailing%2 == 1 {
+			current.WriteString(line[:len(line)-1])
+			pending = true
+			continue
+		}
+		current.WriteString(line)
+		lines = append(lines, current.String())
+		current.Reset()
+		pending = false
+	}
+	if pending {
+		lines = append(lines, current.String())
+	}
+	return lines, nil
+}
+
+func ReadEnsureSingleLine(fs afero.Fs, path string) (string, error) {
+	lines, err := ReadFileLines(fs, path)
+	if err != nil {
+		return "", err
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	if len(lines) > 1 {
+		return "", fmt.Errorf("%s contains multiple lines", path)
+	}
+	return lines[0], nil
+}
+
+// ReadSingleValue is a lenient ReadEnsureSingleLine: it returns the trimmed
+// content of the only non-blank line in path, ignoring blank lines such as
+// the trailing newline many editors add. It errors if path has no non-blank
+// line or more than one.
+func ReadSingleValue(fs afero.Fs, path string) (string, error) {
+	lines, err := ReadFileLines(fs, path)
+	if err != nil {
+		return "", err
+	}
+	var value string
+	var found bool
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if found {
+			return "", fmt.Errorf("%s contains multiple non-empty lines", path)
+		}
+		value, found = line, true
+	}
+	if !found {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return value, nil
+}
+
+// maxSymlinkHops bounds how many symlinks resolveSymlinks follows, after which
+// it assumes a loop; this matches Linux's limit.
+const maxSymlinkHops = 40
+
+// ReadSingleLineResolved is ReadEnsureSingleLine for paths that may be
+// symlinks, such as "current" pointers: it follows the chain of symlinks
+// starting at path and reads the single line of the final target, returning
+// both the line and the target's path. On filesystems without symlink
+// support, path is read directly and returned as the resolved path.
+func ReadSingleLineResolved(fs afero.Fs, path string) (value string, resolvedPath string, err error) {
+	resolvedPath, err = resolveSymlinks(fs, path)
+	if err != nil {
+		return "", "", err
+	}
+	value, err = ReadEnsureSingleLine(fs, resolvedPath)
+	if err != nil {
+		return "", "", err
+	}
+	return value, resolvedPath, nil
+}
+
+// resolveSymlinks follows the chain of symlinks starting at path, resolving
+// relative targets against the directory of the link, and returns the first
+// path that is not a symlink. Symlinks in parent directories are left as is.
+func resolveSymlinks(fs afero.Fs, path string) (string, error) {
+	lstater, ok := fs.(afero.Lstater)
+	if !ok {
+		return path, nil
+	}
+	for i := 0; i < maxSymlinkHops; i++ {
+		info, _, err := lstater.LstatIfPossible(path)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return path, nil
+		}
+		reader, ok := fs.(afero.LinkReader)
+		if !ok {
+			return "", fmt.Errorf("unable to read link %s: filesystem does not support readlink", path)
+		}
+		target, err := reader.ReadlinkIfPossible(path)
+		if err != nil {
+			return "", fmt.Errorf("unable to read link %s: %v", path, err)
+		}
+		path = ResolveRelativeTo(path, target)
+	}
+	return "", fmt.Errorf("unable to resolve %s: too many levels of symbolic links", path)
+}
+
+// ReadFieldFromFile returns the zero-based fieldIndex'th field of the single
+// line in path, as read by ReadEnsureSingleLine. Fields are separated by sep,
+// or by runs of whitespace if sep is empty.
+func ReadFieldFromFile(fs afero.Fs, path string, fieldIndex int, sep string) (string, error) {
+	line, err := ReadEnsureSingleLine(fs, path)
+	if err != nil {
+		return "", err
+	}
+	var fields []string
+	if sep == "" {
+		fields = strings.Fields(line)
+	} else {
+		fields = strings.Split(line, sep)
+	}
+	if fieldIndex < 0 || fieldIndex >= len(fields) {
+		return "", fmt.Errorf("field %d out of range: %s has %d fields", fieldIndex, path, len(fields))
+	}
+	return fields[fieldIndex], nil
+}
+
+// ReadExact reads exactly the first n bytes of path, for fixed-size binary
+// headers, without reading past them. If the file is shorter than n bytes,
+// the returned error wraps io.ErrUnexpectedEOF.
+func ReadExact(fs afero.Fs, path string, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("unable to read %d bytes of %s: negative length", n, path)
+	}
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	buf := make([]byte, n)
+	read, err := io.ReadFull(file, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("unable to read %d bytes of %s, only %d available: %w", n, path, read, io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	return buf, nil
+}
+
+// ReadTrimmedString returns the entire content of path with leading and
+// trailing whitespace removed.
+func ReadTrimmedString(fs afero.Fs, path string) (string, error) {
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// ReadFileExpandEnv reads path and expands ${VAR} and $VAR references in it
+// from the environment, as os.ExpandEnv does. Undefined variables expand to
+// the empty string, and $$ expands to a literal $.
+func ReadFileExpandEnv(fs afero.Fs, path string) ([]byte, error) {
+	return ReadFileExpand(fs, path, os.LookupEnv, false)
+}
+
+// ReadFileExpand is ReadFileExpandEnv with variables looked up with lookup,
+// which has the signature of os.LookupEnv. If strict is true, referencing a
+// variable that lookup does not define is an error rather than expanding to
+// the empty string.
+func ReadFileExpand(fs afero.Fs, path string, lookup func(string) (string, bool), strict bool) ([]byte, error) {
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	var undefined []string
+	expanded := os.Expand(string(content), func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		v, ok := lookup(name)
+		if !ok && strict {
+			undefined = append(undefined, name)
+		}
+		return v
+	})
+	if len(undefined) > 0 {
+		return nil, fmt.Errorf("unable to expand %s: undefined variables %s", path, strings.Join(undefined, ", "))
+	}
+	return []byte(expanded), nil
+}
+
+// ReadFramedContent returns the bytes of path strictly between the first line
+// that is beginMarker and the next line that is endMarker, such as the
+// "-----BEGIN CERTIFICATE-----" lines of a PEM file. Marker lines are matched
+// ignoring surrounding whitespace, and everything before the begin marker and
+// after the end marker is discarded. It errors if either marker is missing, or
+// if an end marker precedes the first begin marker.
+func ReadFramedContent(fs afero.Fs, path, beginMarker, endMarker string) ([]byte, error) {
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	start := -1
+	for off := 0; off < len(content); {
+		line := content[off:]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i+1]
+		}
+		trimmed := string(bytes.TrimSpace(line))
+		switch {
+		case start < 0 && trimmed == beginMarker:
+			start = off + len(line)
+		case trimmed == endMarker && start < 0:
+			return nil, fmt.Errorf("%s: end marker %q precedes begin marker %q", path, endMarker, beginMarker)
+		case trimmed == endMarker:
+			return content[start:off], nil
+		}
+		off += len(line)
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("%s: begin marker %q not found", path, beginMarker)
+	}
+	return nil, fmt.Errorf("%s: end marker %q not found after begin marker %q", path, endMarker, beginMarker)
+}
+
+// ErrNoneExist is returned by ReadFirstExisting when none of the candidate
+// paths exist.
+var ErrNoneExist = errors.New("none of the candidate paths exist")
+
+// ReadFirstExisting returns the path and content of the first of paths that
+// exists. Candidates that do not exist are skipped, but any other error, such
+// as a permission error on an existing candidate, is returned immediately.
+func ReadFirstExisting(fs afero.Fs, paths []string) (path string, content []byte, err error) {
+	for _, path := range paths {
+		content, err := afero.ReadFile(fs, path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return path, nil, fmt.Errorf("unable to read %s: %w", path, err)
+		}
+		return path, content, nil
+	}
+	return "", nil, fmt.Errorf("%w: %s", ErrNoneExist, strings.Join(paths, ", "))
+}
+
+// ErrNotFound is returned by FindInDirs when no directory contains the file.
+var ErrNotFound = errors.New("file not found")
+
+// FindInDirs returns the path of name in the first of dirs that contains a
+// regular file by that name, like a PATH lookup. If requireExec is true, the
+// file must also have an executable bit set. Directories that do not exist are
+// skipped. If no directory matches, an error wrapping ErrNotFound is returned.
+func FindInDirs(fs afero.Fs, name string, dirs []string, requireExec bool) (string, error) {
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		info, err := fs.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("unable to stat %s: %w", path, err)
+		}
+		if !info.Mode().IsRegular() || requireExec && info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf("%w: %s in %s", ErrNotFound, name, strings.Join(dirs, string(filepath.ListSeparator)))
+}
+
+// ReadGlob reads every regular file matching the filepath.Match pattern,
+// returning their contents keyed by path. Matched directories are skipped. As
+// with any map, iteration order is unspecified; callers that need a stable
+// order should sort the keys.
+func ReadGlob(fs afero.Fs, pattern string) (map[string][]byte, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	matches, err := afero.Glob(fs, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list files matching %q: %w", pattern, err)
+	}
+	contents := make(map[string][]byte, len(matches))
+	for _, match := range matches {
+		info, err := fs.Stat(match)
+		if err != nil {
+			return nil, fmt.Errorf("unable to stat %s: %w", match, err)
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		content, err := afero.ReadFile(fs, match)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", match, err)
+		}
+		contents[match] = content
+	}
+	return contents, nil
+}
+
+// OtherPrefix is the CountLinesByPrefix bucket for lines that do not start
+// with any of the requested prefixes.
+const OtherPrefix = "other"
+
+// CountLinesByPrefix scans path once and counts how many lines start with each
+// of the given prefixes. A line is counted against the first prefix it
+// matches, in the order given; lines matching none are counted under
+// OtherPrefix, which therefore cannot itself be one of the prefixes.
+func CountLinesByPrefix(fs afero.Fs, path string, prefixes []string) (map[string]int, error) {
+	for _, p := range prefixes {
+		if p == OtherPrefix {
+			return nil, fmt.Errorf("invalid prefix %q: reserved for lines matching no prefix", p)
+		}
+	}
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	counts := make(map[string]int, len(prefixes)+1)
+	for _, p := range prefixes {
+		counts[p] = 0
+	}
+	counts[OtherPrefix] = 0
+
+	scanner := newLineScanner(file)
+outer:
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, p := range prefixes {
+			if strings.HasPrefix(line, p) {
+				counts[p]++
+				continue outer
+			}
+		}
+		counts[OtherPrefix]++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	return counts, nil
+}
+
+// binarySniffLen is how much of a file IsBinary inspects.
+const binarySniffLen = 8 << 10
+
+// IsBinary heuristically reports whether path holds binary rather than text
+// content, by inspecting its first few KiB: content is binary if it contains
+// a NUL byte or if more than 30% of it are non-printable control characters.
+// Bytes above 0x7f are assumed to be UTF-8 text. An empty file is text.
+func IsBinary(fs afero.Fs, path string) (bool, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	buf = buf[:n]
+	if len(buf) == 0 {
+		return false, nil
+	}
+	var control int
+	for _, b := range buf {
+		switch {
+		case b == 0:
+			return true, nil
+		case b == '\t', b == '\n', b == '\r', b == '\f', b == '\b', b == 0x1b:
+		case b < 0x20, b == 0x7f:
+			control++
+		}
+	}
+	return control*10 > len(buf)*3, nil
+}
+
+func ListFilesInPath(fs afero.Fs, path string) []string {
+	var names []string
+	file, _ := fs.Open(path)
+	files, _ := file.Readdir(0)
+	for _, fileInfo := range files {
+		names = append(names, fileInfo.Name())
+	}
+	return names
+}
+
+// ListDirsInPath returns the names of the subdirectories of path.
+func ListDirsInPath(fs afero.Fs, path string) ([]string, error) {
+	return listEntriesInPath(fs, path, os.FileInfo.IsDir)
+}
+
+// ListRegularFilesInPath returns the names of the regular files in path.
+func ListRegularFilesInPath(fs afero.Fs, path string) ([]string, error) {
+	return listEntriesInPath(fs, path, func(info os.FileInfo) bool {
+		return info.Mode().IsRegular()
+	})
+}
+
+// ReadConfigDir reads every regular file in dir whose name has extension ext,
+// such as ".yaml", in lexical order, and returns their concatenation with each
+// file ending in a newline. Subdirectories and other files are skipped. If dir
+// does not exist, an empty result is returned when allowMissing is true, and
+// an error otherwise.
+func ReadConfigDir(fs afero.Fs, dir, ext string, allowMissing bool) ([]byte, error) {
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	names, err := listEntriesInPath(fs, dir, func(info os.FileInfo) bool {
+		return info.Mode().IsRegular() && filepath.Ext(info.Name()) == ext
+	})
+	if err != nil {
+		if allowMissing && os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		content, err := afero.ReadFile(fs, filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config fragment: %w", err)
+		}
+		buf.Write(content)
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func listEntriesInPath(fs afero.Fs, path string, keep func(os.FileInfo) bool) ([]string, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	infos, err := file.Readdir(0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list %s: %v", path, err)
+	}
+	var names []string
+	for _, info := range infos {
+		if keep(info) {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
+
+// FilesOlderThan returns the paths, relative to root, of the files under root
+// that were last modified more than age ago. Subdirectories are only searched
+// if recursive is true.
+func FilesOlderThan(fs afero.Fs, root string, age time.Duration, recursive bool) ([]string, error) {
+	cutoff := time.Now().Add(-age)
+	return filesByModTime(fs, root, recursive, func(mtime time.Time) bool {
+		return mtime.Before(cutoff)
+	})
+}
+
+// FilesNewerThan returns the paths, relative to root, of the files under root
+// that were last modified less than age ago. Subdirectories are only searched
+// if recursive is true.
+func FilesNewerThan(fs afero.Fs, root string, age time.Duration, recursive bool) ([]string, error) {
+	cutoff := time.Now().Add(-age)
+	return filesByModTime(fs, root, recursive, func(mtime time.Time) bool {
+		return mtime.After(cutoff)
+	})
+}
+
+func filesByModTime(fs afero.Fs, root string, recursive bool, keep func(time.Time) bool) ([]string, error) {
+	if _, err := fs.Stat(root); err != nil {
+		return nil, err
+	}
+	var paths []string
+	err := afero.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !keep(info.ModTime()) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to walk %s: %v", root, err)
+	}
+	return paths, nil
+}
+
+// ResolveRelativeTo resolves ref, a path referenced from within baseFile,
+// relative to the directory containing baseFile. An absolute ref is returned
+// unchanged.
+func ResolveRelativeTo(baseFile, ref string) string {
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Clean(filepath.Join(filepath.Dir(baseFile), ref))
+}
+
+// ReadRelative reads the file at ref, as resolved by ResolveRelativeTo.
+func ReadRelative(fs afero.Fs, baseFile, ref string) ([]byte, error) {
+	return afero.ReadFile(fs, ResolveRelativeTo(baseFile, ref))
+}
+
+// ResolveSymlink returns the absolute, cleaned final target of path, erroring
+// if that target is outside of allowedRoot. The whole chain of links is
+// followed, with relative link targets resolved against the directory holding
+// each link. On an afero.OsFs, symlinks in the parent directories of path and
+// of allowedRoot are resolved too, with filepath.EvalSymlinks; other
+// filesystems only follow links at path itself. If resolving involves no
+// links, or fs cannot lstat, path is returned unchanged.
+func ResolveSymlink(fs afero.Fs, path string, allowedRoot string) (string, error) {
+	_, isOs := fs.(*afero.OsFs)
+	var target string
+	var err error
+	if isOs {
+		target, err = filepath.EvalSymlinks(path)
+		if err != nil {
+			return "", fmt.Errorf("unable to resolve %s: %w", path, err)
+		}
+	} else if target, err = resolveSymlinks(fs, path); err != nil {
+		return "", err
+	}
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve link %s: %v", path, err)
+	}
+	if abs, err := filepath.Abs(path); err == nil && abs == target {
+		return path, nil
+	}
+	root, err := filepath.Abs(allowedRoot)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve %s: %v", allowedRoot, err)
+	}
+	if isOs {
+		if evaluated, err := filepath.EvalSymlinks(root); err == nil {
+			root = evaluated
+		}
+	}
+	if !isWithin(root, target) {
+		return "", fmt.Errorf("link %s points to %s, which is outside of %s", path, target, root)
+	}
+	return target, nil
+}
+
+// RemoveAllUnder is fs.RemoveAll guarded against catastrophic deletions: it
+// refuses to remove anything unless path, once made absolute and cleaned, is
+// strictly inside allowedRoot. Empty paths and allowedRoot itself are always
+// refused.
+func RemoveAllUnder(fs afero.Fs, path, allowedRoot string) error {
+	if path == "" || allowedRoot == "" {
+		return fmt.Errorf("refusing to remove %q under %q: empty path", path, allowedRoot)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("unable to resolve %s: %v", path, err)
+	}
+	root, err := filepath.Abs(allowedRoot)
+	if err != nil {
+		return fmt.Errorf("unable to resolve %s: %v", allowedRoot, err)
+	}
+	if abs == root {
+		return fmt.Errorf("refusing to remove %s: it is the allowed root itself", abs)
+	}
+	if !isWithin(root, abs) {
+		return fmt.Errorf("refusing to remove %s: it is outside of %s", abs, root)
+	}
+	return fs.RemoveAll(abs)
+}
+
+// isWithin returns whether path is root or is underneath it. Both paths must
+// be absolute and clean.
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// DeleteMatching removes the files matching the filepath.Match pattern and
+// returns how many were removed. As with filepath.Glob, only path segments
+// named by the pattern are searched; directories are never descended into
+// implicitly, and matched directories are skipped. Files that vanish before
+// they can be removed are skipped.
+func DeleteMatching(fs afero.Fs, pattern string) (int, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return 0, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	matches, err := afero.Glob(fs, pattern)
+	if err != nil {
+		return 0, fmt.Errorf("unable to list files matching %q: %w", pattern, err)
+	}
+	var removed int
+	for _, match := range matches {
+		info, err := fs.Stat(match)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return removed, fmt.Errorf("unable to stat %s: %v", match, err)
+		}
+		if info.IsDir() {
+			continue
+		}
+		if err := fs.Remove(match); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return removed, fmt.Errorf("unable to remove %s: %v", match, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// FileMeta is the subset of file metadata that rpk commonly inspects.
+type FileMeta struct {
+	Path    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	IsDir   bool
+}
+
+// StatFile returns the FileMeta of path.
+func StatFile(fs afero.Fs, path string) (FileMeta, error) {
+	info, err := fs.Stat(path)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	return FileMeta{
+		Path:    path,
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}, nil
+}
+
+// StatAll stats every path, returning the metadata of the paths that could be
+// stat-ed and the error for each path that could not. It never stops early,
+// so that callers can report every failure at once.
+func StatAll(fs afero.Fs, paths []string) (map[string]FileMeta, map[string]error) {
+	metas := make(map[string]FileMeta, len(paths))
+	errs := make(map[string]error)
+	for _, path := range paths {
+		meta, err := StatFile(fs, path)
+		if err != nil {
+			errs[path] = err
+			continue
+		}
+		metas[path] = meta
+	}
+	return metas, errs
+}
+
+// CheckFileMode returns whether the permission bits of path match those of
+// want, along with the file's actual permission bits.
+func CheckFileMode(fs afero.Fs, path string, want os.FileMode) (bool, os.FileMode, error) {
+	info, err := fs.Stat(path)
+	if os.IsNotExist(err) {
+		return false, 0, fmt.Errorf("unable to check mode of %s: file does not exist", path)
+	}
+	if err != nil {
+		return false, 0, fmt.Errorf("unable to stat %s: %v", path, err)
+	}
+	actual := info.Mode() & os.ModePerm
+	return actual == want&os.ModePerm, actual, nil
+}
+
+var (
+	// ErrFileTooSmall is returned by CheckFileSizeRange when a file is
+	// smaller than the minimum size.
+	ErrFileTooSmall = errors.New("file is too small")
+	// ErrFileTooLarge is returned by CheckFileSizeRange when a file is
+	// larger than the maximum size.
+	ErrFileTooLarge = errors.New("file is too large")
+)
+
+// CheckFileSizeRange returns an error wrapping ErrFileTooSmall or
+// ErrFileTooLarge if the size of path is below min or above max bytes. A max
+// of 0 means there is no upper bound.
+func CheckFileSizeRange(fs afero.Fs, path string, min, max int64) error {
+	info, err := fs.Stat(path)
+	if err != nil {
+		return fmt.Errorf("unable to stat %s: %w", path, err)
+	}
+	size := info.Size()
+	if size < min {
+		return fmt.Errorf("%w: %s is %d bytes, expected at least %d", ErrFileTooSmall, path, size, min)
+	}
+	if max > 0 && size > max {
+		return fmt.Errorf("%w: %s is %d bytes, expected at most %d", ErrFileTooLarge, path, size, max)
+	}
+	return nil
+}
+
+// MkdirTemp creates a uniquely named directory, starting with pattern, under
+// parent, or under the default temporary directory if parent is empty. The
+// returned cleanup function recursively removes the directory and everything
+// created inside it; it is safe to call more than once.
+func MkdirTemp(fs afero.Fs, parent, pattern string) (dir string, cleanup func() error, err error) {
+	dir, err = afero.TempDir(fs, parent, pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to create temporary directory: %v", err)
+	}
+	return dir, func() error { return fs.RemoveAll(dir) }, nil
+}
+
+func CopyFile(fs afero.Fs, src string, dst string) error {
+	input, err := afero.ReadFile(fs, src)
+	if err != nil {
+		return err
+	}
+	err = afero.WriteFile(fs, dst, input, 0o644)
+	return err
+}
+
+// CopyFileWithHash is like CopyFile, but streams the copy and also returns the
+// hex encoded digest, computed with h, of the bytes written to dst. h is reset
+// before use. The copy is staged in a temporary file, so a failed copy leaves
+// dst untouched, and copying a file onto itself is an error.
+func CopyFileWithHash(fs afero.Fs, src, dst string, h hash.Hash) (string, error) {
+	if err := checkDistinctFiles(fs, src, dst); err != nil {
+		return "", err
+	}
+	in, err := fs.Open(src)
+	if err != nil {
+		return "", err
 	}
-	defer file.Close()
+	defer in.Close()
+	out, err := createAtomicFile(fs, dst, 0o644)
+	if err != nil {
+		return "", err
+	}
+	h.Reset()
+	if _, err := io.Copy(io.MultiWriter(out, h), in); err != nil {
+		out.Abort()
+		return "", fmt.Errorf("unable to copy %s to %s: %v", src, dst, err)
+	}
+	if err := out.Commit(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+// CopyFileInto is like CopyFile, but copies src, streaming it, into dstDir
+// under its own base name, and returns the destination path. dstDir is created
+// if missing, but must not be an existing regular file, nor the directory src
+// is already in. The copy is staged in a temporary file, so a failed copy
+// leaves any existing destination untouched.
+func CopyFileInto(fs afero.Fs, src, dstDir string) (string, error) {
+	info, err := fs.Stat(dstDir)
+	switch {
+	case os.IsNotExist(err):
+		if err := fs.MkdirAll(dstDir, 0o755); err != nil {
+			return "", fmt.Errorf("unable to create %s: %v", dstDir, err)
+		}
+	case err != nil:
+		return "", fmt.Errorf("unable to stat %s: %v", dstDir, err)
+	case !info.IsDir():
+		return "", fmt.Errorf("unable to copy %s into %s: not a directory", src, dstDir)
 	}
+	dst := filepath.Join(dstDir, filepath.Base(src))
+	if err := checkDistinctFiles(fs, src, dst); err != nil {
+		return "", err
+	}
+	return dst, copyFileWithMode(fs, src, dst, 0o644)
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+// checkDistinctFiles errors if src and dst are the same path, or, if both
+// exist, the same file, as copying a file over itself would truncate it.
+func checkDistinctFiles(fs afero.Fs, src, dst string) error {
+	same := filepath.Clean(src) == filepath.Clean(dst)
+	if !same {
+		srcInfo, srcErr := fs.Stat(src)
+		dstInfo, dstErr := fs.Stat(dst)
+		same = srcErr == nil && dstErr == nil && os.SameFile(srcInfo, dstInfo)
 	}
-	return lines, nil
+	if same {
+		return fmt.Errorf("unable to copy %s to %s: source and destination are the same file", src, dst)
+	}
+	return nil
 }
 
-func ReadEnsureSingleLine(fs afero.Fs, path string) (string, error) {
-	lines, err := ReadFileLines(fs, path)
+// SwapFiles exchanges the files at a and b, which must both exist; if either
+// does not, neither is touched. On Linux with an OS-backed fs, the exchange is
+// atomic via renameat2(RENAME_EXCHANGE). Otherwise it falls back to renaming a
+// to a temporary name, b to a, and the temporary to b: in the brief window
+// between the first two renames a does not exist, and between the last two b
+// does not exist. If a fallback rename fails, the earlier ones are undone.
+func SwapFiles(fs afero.Fs, a, b string) error {
+	for _, path := range []string{a, b} {
+		if _, err := fs.Stat(path); err != nil {
+			return fmt.Errorf("unable to swap %s and %s: %w", a, b, err)
+		}
+	}
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return nil
+	}
+	if ok, err := exchangeFiles(fs, a, b); ok || err != nil {
+		return err
+	}
+
+	// We only use the temporary file to reserve a unique name next to a,
+	// the rename below replaces it.
+	temp, err := createTempFile(fs, a)
 	if err != nil {
-		return "", err
+		return err
 	}
-	if len(lines) == 0 {
-		return "", fmt.Errorf("%s is empty", path)
+	tempName := temp.Name()
+	temp.Close()
+	if err := fs.Rename(a, tempName); err != nil {
+		fs.Remove(tempName)
+		return fmt.Errorf("unable to move %s aside: %v", a, err)
 	}
-	if len(lines) > 1 {
-		return "", fmt.Errorf("%s contains multiple lines", path)
+	if err := fs.Rename(b, a); err != nil {
+		fs.Rename(tempName, a)
+		return fmt.Errorf("unable to rename %s to %s: %v", b, a, err)
 	}
-	return lines[0], nil
+	if err := fs.Rename(tempName, b); err != nil {
+		fs.Rename(a, b)
+		fs.Rename(tempName, a)
+		return fmt.Errorf("unable to rename %s to %s: %v", a, b, err)
+	}
+	return nil
 }
 
-func ListFilesInPath(fs afero.Fs, path string) []string {
-	var names []string
-	file, _ := fs.Open(path)
-	files, _ := file.Readdir(0)
-	for _, fileInfo := range files {
-		names = append(names, fileInfo.Name())
+// CopyFilesAtomic copies every src to dst pair in pairs, or none of them. All
+// sources are first copied to temporary files next to their destinations, and
+// only once every copy succeeded are they renamed into place. If any copy
+// fails, the temporary files are removed and existing destinations are left
+// untouched.
+//
+// Renames are not transactional: if a rename fails after others succeeded,
+// the already renamed destinations are not rolled back.
+func CopyFilesAtomic(fs afero.Fs, pairs map[string]string) (rerr error) {
+	srcs := make([]string, 0, len(pairs))
+	for src := range pairs {
+		srcs = append(srcs, src)
 	}
-	return names
+	sort.Strings(srcs)
+
+	temps := make(map[string]string, len(pairs))
+	defer func() {
+		if rerr != nil {
+			for _, temp := range temps {
+				fs.Remove(temp)
+			}
+		}
+	}()
+	for _, src := range srcs {
+		dst := pairs[src]
+		input, err := afero.ReadFile(fs, src)
+		if err != nil {
+			return fmt.Errorf("unable to copy %s to %s: %v", src, dst, err)
+		}
+		temp, err := writeTempFile(fs, dst, input, 0o644)
+		if err != nil {
+			return fmt.Errorf("unable to copy %s to %s: %v", src, dst, err)
+		}
+		temps[src] = temp
+	}
+	for _, src := range srcs {
+		dst := pairs[src]
+		if err := fs.Rename(temps[src], dst); err != nil {
+			return fmt.Errorf("unable to move %s into place at %s: %v", src, dst, err)
+		}
+		delete(temps, src)
+	}
+	return nil
 }
 
-func CopyFile(fs afero.Fs, src string, dst string) error {
-	input, err := afero.ReadFile(fs, src)
+// ValidateWritablePath checks that path can be written as a regular file:
+// its parent must exist and be a directory, path itself must not be a
+// directory, and, if path does not exist yet, the current user must be able
+// to create files in the parent. That last check asks the OS with access(2),
+// so it accounts for ownership, root and read-only mounts; it is only done on
+// an afero.OsFs, and never on Windows. Each failure returns an error
+// describing what is wrong with path.
+func ValidateWritablePath(fs afero.Fs, path string) error {
+	parent := filepath.Dir(path)
+	pinfo, err := fs.Stat(parent)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("unable to write %s: parent directory %s does not exist", path, parent)
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("unable to write %s: unable to stat parent directory: %v", path, err)
 	}
-	err = afero.WriteFile(fs, dst, input, 0o644)
-	return err
+	if !pinfo.IsDir() {
+		return fmt.Errorf("unable to write %s: parent %s is not a directory", path, parent)
+	}
+	info, err := fs.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		return fmt.Errorf("unable to write %s: path is a directory, expected a file path", path)
+	case err == nil:
+		return nil
+	case !os.IsNotExist(err):
+		return fmt.Errorf("unable to write %s: unable to stat: %v", path, err)
+	}
+	if _, ok := fs.(*afero.OsFs); ok {
+		if err := checkDirWritable(parent); err != nil {
+			return fmt.Errorf("unable to write %s: parent directory %s is not writable: %v", path, parent, err)
+		}
+	}
+	return nil
 }
 
 func WriteFileLines(fs afero.Fs, lines []string, path string) error {
+	if err := ValidateWritablePath(fs, path); err != nil {
+		return err
+	}
 	return afero.WriteFile(fs, path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
 }
 
+// WriteFileLinesWithHeader writes the header lines followed by the body lines
+// to path, separated by exactly one blank line. Formatting the header as
+// comments is left to the caller. The file is written atomically with 0o600.
+func WriteFileLinesWithHeader(fs afero.Fs, lines []string, path string, header []string) error {
+	for len(header) > 0 && strings.TrimSpace(header[len(header)-1]) == "" {
+		header = header[:len(header)-1]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	all := make([]string, 0, len(header)+1+len(lines))
+	if len(header) > 0 {
+		all = append(all, header...)
+		all = append(all, "")
+	}
+	all = append(all, lines...)
+	return writeFileAtomic(fs, path, []byte(strings.Join(all, "\n")+"\n"), 0o600)
+}
+
+// WriteFileLinesLimited is like WriteFileLines, but refuses to write anything
+// if the serialized content would be larger than maxBytes. Otherwise, the file
+// is written atomically with 0o600.
+func WriteFileLinesLimited(fs afero.Fs, lines []string, path string, maxBytes int64) error {
+	// Lines are joined by, and terminated with, a newline; an empty slice
+	// serializes to a single newline.
+	size := int64(len(lines))
+	if size == 0 {
+		size = 1
+	}
+	for _, line := range lines {
+		size += int64(len(line))
+	}
+	if size > maxBytes {
+		return fmt.Errorf("refusing to write %s: content is %d bytes, exceeding the limit of %d bytes", path, size, maxBytes)
+	}
+	return writeFileAtomic(fs, path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+}
+
+// EnsureFileContent ensures that path contains exactly content and has the
+// permission bits of mode, returning whether anything had to be changed. A
+// file with different content is rewritten atomically, while a file with only
+// different permissions is chmod-ed. A missing file is created.
+func EnsureFileContent(fs afero.Fs, path string, content []byte, mode os.FileMode) (changed bool, err error) {
+	info, err := fs.Stat(path)
+	if os.IsNotExist(err) {
+		return true, writeFileAtomic(fs, path, content, mode.Perm())
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to stat %s: %v", path, err)
+	}
+	existing, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return false, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	if !bytes.Equal(existing, content) {
+		return true, writeFileAtomic(fs, path, content, mode.Perm())
+	}
+	if info.Mode().Perm() != mode.Perm() {
+		if err := fs.Chmod(path, mode.Perm()); err != nil {
+			return false, fmt.Errorf("unable to chmod %s: %v", path, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// CreateIfAbsent creates path with content and mode if it does not exist, and
+// returns whether it did; an existing file is never touched. Creation uses
+// O_CREATE|O_EXCL, so of several concurrent callers exactly one creates the
+// file. Readers may briefly see it partially written. The parent directory
+// must exist. If writing fails, the new file is removed.
+func CreateIfAbsent(fs afero.Fs, path string, content []byte, mode os.FileMode) (created bool, err error) {
+	// MemMapFs creates missing parents implicitly; we do not want to.
+	if _, err := fs.Stat(filepath.Dir(path)); err != nil {
+		return false, fmt.Errorf("unable to create %s: %w", path, err)
+	}
+	f, err := fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to create %s: %w", path, err)
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		fs.Remove(path)
+		return false, fmt.Errorf("unable to write %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		fs.Remove(path)
+		return false, fmt.Errorf("unable to write %s: %v", path, err)
+	}
+	return true, nil
+}
+
+// ReplaceFilePreservingMeta atomically replaces the contents of path, keeping
+// the permissions and, where the filesystem exposes them, the owner and group
+// of the existing file. If path does not exist, it is created with 0o600.
+func ReplaceFilePreservingMeta(fs afero.Fs, path string, content []byte) error {
+	info, err := fs.Stat(path)
+	if os.IsNotExist(err) {
+		return writeFileAtomic(fs, path, content, 0o600)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to stat %s: %v", path, err)
+	}
+	temp, err := writeTempFile(fs, path, content, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if err := preserveOwnership(fs, info, temp); err != nil {
+		fs.Remove(temp)
+		return err
+	}
+	if err := fs.Rename(temp, path); err != nil {
+		fs.Remove(temp)
+		return fmt.Errorf("unable to rename temporary file to %q: %v", path, err)
+	}
+	return nil
+}
+
+// MergeSortedFiles merges the lines of a and b into dst, which is written
+// atomically with 0o600. Both inputs must already be sorted in byte order; the
+// merge streams them, so memory use does not depend on their size. If dedup is
+// true, repeated lines, whether from the same or different inputs, are written
+// only once.
+func MergeSortedFiles(fs afero.Fs, a, b, dst string, dedup bool) (rerr error) {
+	fa, err := fs.Open(a)
+	if err != nil {
+		return err
+	}
+	defer fa.Close()
+	fb, err := fs.Open(b)
+	if err != nil {
+		return err
+	}
+	defer fb.Close()
+
+	out, err := createAtomicFile(fs, dst, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr != nil {
+			out.Abort()
+		}
+	}()
+
+	var (
+		sa, sb     = newLineScanner(fa), newLineScanner(fb)
+		okA, okB   = sa.Scan(), sb.Scan()
+		w          = bufio.NewWriter(out)
+		last       string
+		wroteFirst bool
+	)
+	for okA || okB {
+		var line string
+		if okA && (!okB || sa.Text() <= sb.Text()) {
+			line = sa.Text()
+			okA = sa.Scan()
+		} else {
+			line = sb.Text()
+			okB = sb.Scan()
+		}
+		if dedup && wroteFirst && line == last {
+			continue
+		}
+		if _, err := w.WriteString(line + "\n"); err != nil {
+			return fmt.Errorf("unable to write %s: %v", dst, err)
+		}
+		last, wroteFirst = line, true
+	}
+	if err := sa.Err(); err != nil {
+		return fmt.Errorf("unable to read %s: %v", a, err)
+	}
+	if err := sb.Err(); err != nil {
+		return fmt.Errorf("unable to read %s: %v", b, err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("unable to write %s: %v", dst, err)
+	}
+	return out.Commit()
+}
+
+// WriteFileLinesBackup backs up path with BackupFile and then atomically
+// overwrites it with lines, using 0o600, returning the path of the backup.
+// If path does not exist yet, no backup is made and the returned path is
+// empty.
+func WriteFileLinesBackup(fs afero.Fs, lines []string, path string) (backupPath string, err error) {
+	exists, err := afero.Exists(fs, path)
+	if err != nil {
+		return "", fmt.Errorf("unable to determine if %s exists: %v", path, err)
+	}
+	if exists {
+		if backupPath, err = BackupFile(fs, path); err != nil {
+			return "", err
+		}
+	}
+	return backupPath, writeFileAtomic(fs, path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+}
+
+// WriteFileLinesDeterministic is like WriteFileLines, but normalizes the lines
+// so that inputs differing only in incidental whitespace produce identical
+// files: trailing whitespace is trimmed from every line, and blank lines at the
+// end are dropped. The file ends with exactly one newline, or is empty if no
+// line has content. It is written atomically with 0o600.
+func WriteFileLinesDeterministic(fs afero.Fs, lines []string, path string) error {
+	normalized := make([]string, len(lines))
+	for i, line := range lines {
+		normalized[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	for len(normalized) > 0 && normalized[len(normalized)-1] == "" {
+		normalized = normalized[:len(normalized)-1]
+	}
+	var contents []byte
+	if len(normalized) > 0 {
+		contents = []byte(strings.Join(normalized, "\n") + "\n")
+	}
+	return writeFileAtomic(fs, path, contents, 0o600)
+}
+
+// WriteWrappedLines is like WriteFileLines, but first wraps every line longer
+// than width columns at word boundaries; shorter lines are written unchanged.
+// The leading whitespace of a wrapped line is kept on its first segment, and a
+// long line of only whitespace becomes an empty line. Words longer than width
+// are not split, but placed on a line of their own. The file is written
+// atomically with 0o600.
+func WriteWrappedLines(fs afero.Fs, lines []string, path string, width int) error {
+	if width <= 0 {
+		return fmt.Errorf("invalid wrap width %d: must be positive", width)
+	}
+	var wrapped []string
+	for _, line := range lines {
+		wrapped = append(wrapped, wrapLine(line, width)...)
+	}
+	return writeFileAtomic(fs, path, []byte(strings.Join(wrapped, "\n")+"\n"), 0o600)
+}
+
+func wrapLine(line string, width int) []string {
+	if utf8.RuneCountInString(line) <= width {
+		return []string{line}
+	}
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return []string{""}
+	}
+	indent := line[:len(line)-len(strings.TrimLeftFunc(line, unicode.IsSpace))]
+	var (
+		wrapped []string
+		cur     strings.Builder
+		curLen  = utf8.RuneCountInString(indent)
+		empty   = true // Whether cur has no word yet.
+	)
+	cur.WriteString(indent)
+	for _, word := range words {
+		wordLen := utf8.RuneCountInString(word)
+		if !empty && curLen+1+wordLen > width {
+			wrapped = append(wrapped, cur.String())
+			cur.Reset()
+			curLen = 0
+			empty = true
+		}
+		if !empty {
+			cur.WriteByte(' ')
+			curLen++
+		}
+		cur.WriteString(word)
+		curLen += wordLen
+		empty = false
+	}
+	return append(wrapped, cur.String())
+}
+
 func WriteBytes(fs afero.Fs, bs []byte, path string) (int, error) {
+	if err := ValidateWritablePath(fs, path); err != nil {
+		return 0, err
+	}
 	return len(bs), afero.WriteFile(fs, path, bs, 0o600)
 }
 
+// WriteFileLinesSync is like WriteFileLines, but durable: the content is
+// written to a temporary file next to path and fsynced, the temporary file is
+// renamed over path, and, on an afero.OsFs, the parent directory is fsynced
+// so that the rename itself is durable. A nil error means path holds the new
+// content on disk; a power loss at any point leaves either the old or the new
+// content, never a partial file. Filesystems that do not support syncing, such
+// as an in-memory afero.Fs, are written without syncing.
+func WriteFileLinesSync(fs afero.Fs, lines []string, path string) error {
+	return writeFileSync(fs, path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+}
+
+// WriteBytesSync is like WriteBytes, but with the same durability guarantee as
+// WriteFileLinesSync.
+func WriteBytesSync(fs afero.Fs, bs []byte, path string) (int, error) {
+	return len(bs), writeFileSync(fs, path, bs, 0o600)
+}
+
+// writeFileSync is writeFileAtomic with the temporary file fsynced before the
+// rename and the parent directory fsynced after it. Syncs are skipped where
+// unsupported.
+func writeFileSync(fs afero.Fs, path string, contents []byte, perm os.FileMode) (rerr error) {
+	temp, err := createTempFile(fs, path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr != nil {
+			fs.Remove(temp.Name())
+		}
+	}()
+	if _, err := temp.Write(contents); err != nil {
+		temp.Close()
+		return fmt.Errorf("unable to write temporary file for %q: %v", path, err)
+	}
+	if err := temp.Sync(); err != nil && !isSyncUnsupported(err) {
+		temp.Close()
+		return fmt.Errorf("unable to sync temporary file for %q: %v", path, err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("unable to close temporary file for %q: %v", path, err)
+	}
+	if err := fs.Chmod(temp.Name(), perm); err != nil {
+		return fmt.Errorf("unable to chmod temporary file for %q: %v", path, err)
+	}
+	if err := fs.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("unable to rename temporary file to %q: %v", path, err)
+	}
+	if _, ok := fs.(*afero.OsFs); ok {
+		if err := syncDir(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("unable to sync directory of %q: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// isSyncUnsupported returns whether err from a sync means the file does not
+// support syncing, rather than that syncing failed.
+func isSyncUnsupported(err error) bool {
+	return errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTSUP)
+}
+
+// AppendWithRotation appends line, followed by a newline, to path. If the
+// append would grow a non-empty file beyond maxBytes, the file is rotated
+// first: path.N-1 is shifted to path.N and so on, for up to maxBackups
+// backups, dropping the oldest, and path itself becomes path.1.
+//
+// Backups are shifted before the active file is renamed, so a crash during
+// rotation can lose at most the oldest backup, never the active file.
+func AppendWithRotation(fs afero.Fs, line string, path string, maxBytes int64, maxBackups int) error {
+	entry := line + "\n"
+	info, err := fs.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to stat %s: %v", path, err)
+	}
+	if err == nil && info.Size() > 0 && info.Size()+int64(len(entry)) > maxBytes {
+		if err := rotateFile(fs, path, maxBackups); err != nil {
+			return err
+		}
+	}
+
+	f, err := fs.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %v", path, err)
+	}
+	if _, err := f.WriteString(entry); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to append to %s: %v", path, err)
+	}
+	return f.Close()
+}
+
+// AppendBounded appends line, followed by a newline, to path only if the file
+// would still be at most maxBytes afterwards, and returns whether it did. A
+// missing file is created with 0o600, but only if the line fits; a refused
+// append never touches the filesystem. The append uses O_APPEND, so concurrent
+// appenders never overwrite each other's lines, but the size check is not
+// coordinated between processes: concurrent appenders that each see room for
+// their line can together exceed maxBytes.
+func AppendBounded(fs afero.Fs, line string, path string, maxBytes int64) (bool, error) {
+	entry := line + "\n"
+	f, err := fs.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		if int64(len(entry)) > maxBytes {
+			return false, nil
+		}
+		f, err = fs.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to open %s: %v", path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return false, fmt.Errorf("unable to stat %s: %v", path, err)
+	}
+	if info.Size()+int64(len(entry)) > maxBytes {
+		return false, f.Close()
+	}
+	if _, err := f.WriteString(entry); err != nil {
+		f.Close()
+		return false, fmt.Errorf("unable to append to %s: %v", path, err)
+	}
+	return true, f.Close()
+}
+
+func rotateFile(fs afero.Fs, path string, maxBackups int) error {
+	if maxBackups <= 0 {
+		if err := fs.Remove(path); err != nil {
+			return fmt.Errorf("unable to remove %s during rotation: %v", path, err)
+		}
+		return nil
+	}
+	backup := func(n int) string { return fmt.Sprintf("%s.%d", path, n) }
+	if err := fs.Remove(backup(maxBackups)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove oldest backup %s: %v", backup(maxBackups), err)
+	}
+	for n := maxBackups - 1; n >= 1; n-- {
+		exists, err := afero.Exists(fs, backup(n))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if err := fs.Rename(backup(n), backup(n+1)); err != nil {
+			return fmt.Errorf("unable to shift backup %s: %v", backup(n), err)
+		}
+	}
+	if err := fs.Rename(path, backup(1)); err != nil {
+		return fmt.Errorf("unable to rotate %s: %v", path, err)
+	}
+	return nil
+}
+
+// EnsureLinePresent appends line to path unless the file already contains it
+// as an exact line, and returns whether it was appended. If the file does not
+// end with a newline, one is added before the line. A missing file is created
+// with 0o600, containing just the line.
+func EnsureLinePresent(fs afero.Fs, path, line string) (bool, error) {
+	content, err := afero.ReadFile(fs, path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	scanner := newLineScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if scanner.Text() == line {
+			return false, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+
+	entry := line + "\n"
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		entry = "\n" + entry
+	}
+	f, err := fs.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return false, fmt.Errorf("unable to open %s: %v", path, err)
+	}
+	if _, err := f.WriteString(entry); err != nil {
+		f.Close()
+		return false, fmt.Errorf("unable to append to %s: %v", path, err)
+	}
+	return true, f.Close()
+}
+
+// SetKeyLine sets key to value in a key<sep>value style file: the first line
+// that sets key, parsed as KVDoc does so that whitespace around sep and
+// comment lines are handled the same, is replaced with key<sep>value, or, if
+// there is none, key<sep>value is appended. It returns
+// whether an existing line was replaced. The file is written atomically, with
+// every other byte and the file's mode preserved: an appended line uses the
+// file's line terminator, and a file that did not end with a newline still
+// does not. A missing file is created with 0o600.
+func SetKeyLine(fs afero.Fs, path, key, value, sep string) (bool, error) {
+	entry := key + sep + value
+	info, err := fs.Stat(path)
+	if os.IsNotExist(err) {
+		return false, writeFileAtomic(fs, path, []byte(entry+"\n"), 0o600)
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to stat %s: %v", path, err)
+	}
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return false, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+
+	lines := splitLinesKeepEnds(string(content))
+	eol := "\n"
+	if len(lines) > 0 {
+		if _, end := cutLineEnding(lines[0]); end != "" {
+			eol = end
+		}
+	}
+	replaced := false
+	for i, line := range lines {
+		text, end := cutLineEnding(line)
+		if l := parseKVLine(text, sep); l.isValue && l.key == key {
+			lines[i] = entry + end
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		if n := len(lines); n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+			lines[n-1] += eol
+			lines = append(lines, entry)
+		} else {
+			lines = append(lines, entry+eol)
+		}
+	}
+	return replaced, writeFileAtomic(fs, path, []byte(strings.Join(lines, "")), info.Mode().Perm())
+}
+
+// splitLinesKeepEnds splits s into lines that keep their "\n" or "\r\n"
+// terminator. The last line has no terminator if s does not end in a newline.
+func splitLinesKeepEnds(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// cutLineEnding splits a line returned by splitLinesKeepEnds into its text
+// and its terminator, which is "\n", "\r\n" or empty.
+func cutLineEnding(line string) (text, end string) {
+	switch {
+	case strings.HasSuffix(line, "\r\n"):
+		return line[:len(line)-2], "\r\n"
+	case strings.HasSuffix(line, "\n"):
+		return line[:len(line)-1], "\n"
+	}
+	return line, ""
+}
+
 func FileMd5(fs afero.Fs, filePath string) (string, error) {
 	var returnMD5String string
 	file, err := fs.Open(filePath)
@@ -97,6 +2151,39 @@ func FileMd5(fs afero.Fs, filePath string) (string, error) {
 	return returnMD5String, nil
 }
 
+// ErrHashMismatch is returned when a file's digest does not match the
+// expected one.
+var ErrHashMismatch = errors.New("hash mismatch")
+
+// RemoveIfHashMatches removes path only if its digest, computed with h,
+// matches expectedHex. Otherwise the file is left intact and an error
+// wrapping ErrHashMismatch is returned.
+func RemoveIfHashMatches(fs afero.Fs, path, expectedHex string, h hash.Hash) error {
+	sum, err := fileDigest(fs, path, h)
+	if err != nil {
+		return err
+	}
+	if sum != strings.ToLower(expectedHex) {
+		return fmt.Errorf("not removing %s: %w: got %s, expected %s", path, ErrHashMismatch, sum, expectedHex)
+	}
+	return fs.Remove(path)
+}
+
+// fileDigest returns the hex encoded digest, computed with h, of the contents
+// of path. h is reset before use.
+func fileDigest(fs afero.Fs, path string, h hash.Hash) (string, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h.Reset()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 func BackupFile(fs afero.Fs, filePath string) (string, error) {
 	md5, err := FileMd5(fs, filePath)
 	if err != nil {
@@ -110,6 +2197,40 @@ func BackupFile(fs afero.Fs, filePath string) (string, error) {
 	return bkFilePath, nil
 }
 
+// ListBackups returns the backups of filePath made by BackupFile, newest
+// first by modification time.
+func ListBackups(fs afero.Fs, filePath string) ([]string, error) {
+	dir, base := filepath.Split(filePath)
+	if dir == "" {
+		dir = "."
+	}
+	prefix := base + ".vectorized."
+	infos, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list backups of %s: %v", filePath, err)
+	}
+	var backups []os.FileInfo
+	for _, info := range infos {
+		name := info.Name()
+		if !info.Mode().IsRegular() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".bk") {
+			continue
+		}
+		sum := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".bk")
+		if _, err := hex.DecodeString(sum); err != nil || len(sum) != md5.Size*2 {
+			continue
+		}
+		backups = append(backups, info)
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].ModTime().After(backups[j].ModTime())
+	})
+	paths := make([]string, len(backups))
+	for i, info := range backups {
+		paths[i] = filepath.Join(dir, info.Name())
+	}
+	return paths, nil
+}
+
 func ReadIntFromFile(fs afero.Fs, file string) (int, error) {
 	content, err := ReadEnsureSingleLine(fs, file)
 	if err != nil {
@@ -117,3 +2238,83 @@ func ReadIntFromFile(fs afero.Fs, file string) (int, error) {
 	}
 	return strconv.Atoi(strings.TrimSpace(content))
 }
+
+// ReadPidFile reads the process ID in the single-line file at path and
+// reports whether a process with that ID is running. The check is best-effort,
+// as the ID may have been reused by an unrelated process, and it is only done
+// when fs is an afero.OsFs; on other filesystems running is always false.
+func ReadPidFile(fs afero.Fs, path string) (pid int, running bool, err error) {
+	line, err := ReadEnsureSingleLine(fs, path)
+	if err != nil {
+		return 0, false, fmt.Errorf("unable to read pid file: %w", err)
+	}
+	pid, err = strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || pid <= 0 {
+		return 0, false, fmt.Errorf("pid file %s contains %q, expected a positive process ID", path, line)
+	}
+	if _, ok := fs.(*afero.OsFs); !ok {
+		return pid, false, nil
+	}
+	return pid, processExists(pid), nil
+}
+
+// rewriteFileLines atomically replaces the contents of the existing file at
+// path with lines, preserving the file's permissions.
+func rewriteFileLines(fs afero.Fs, path string, lines []string) error {
+	info, err := fs.Stat(path)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fs, path, []byte(strings.Join(lines, "\n")+"\n"), info.Mode().Perm())
+}
+
+// writeFileAtomic writes contents to a temporary file next to path and then
+// renames it into place, so that readers never observe a partial write. On
+// failure the temporary file is removed and any existing file is untouched.
+func writeFileAtomic(fs afero.Fs, path string, contents []byte, perm os.FileMode) error {
+	temp, err := writeTempFile(fs, path, contents, perm)
+	if err != nil {
+		return err
+	}
+	if err := fs.Rename(temp, path); err != nil {
+		fs.Remove(temp)
+		return fmt.Errorf("unable to rename temporary file to %q: %v", path, err)
+	}
+	return nil
+}
+
+// writeTempFile writes contents with perm to a new temporary file in the same
+// directory as path, returning the temporary file's name. The caller is
+// responsible for renaming or removing it.
+func writeTempFile(fs afero.Fs, path string, contents []byte, perm os.FileMode) (name string, rerr error) {
+	temp, err := createTempFile(fs, path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if rerr != nil {
+			fs.Remove(temp.Name())
+		}
+	}()
+	if _, err := temp.Write(contents); err != nil {
+		temp.Close()
+		return "", fmt.Errorf("unable to write temporary file for %q: %v", path, err)
+	}
+	if err := temp.Close(); err != nil {
+		return "", fmt.Errorf("unable to close temporary file for %q: %v", path, err)
+	}
+	if err := fs.Chmod(temp.Name(), perm); err != nil {
+		return "", fmt.Errorf("unable to chmod temporary file for %q: %v", path, err)
+	}
+	return temp.Name(), nil
+}
+
+// createTempFile creates a new temporary file in the same directory as path,
+// so that it can later be renamed over path.
+func createTempFile(fs afero.Fs, path string) (afero.File, error) {
+	temp, err := afero.TempFile(fs, filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create temporary file for %q: %v", path, err)
+	}
+	return temp, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+//go:build !windows
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/spf13/afero"
+	"golang.org/x/sys/unix"
+)
+
+// preserveOwnership chowns file to the owner and group in stat.
+func preserveOwnership(fs afero.Fs, stat os.FileInfo, file string) error {
+	// Stat_t is only valid in unix not on Windows.
+	if stat, ok := stat.Sys().(*syscall.Stat_t); ok {
+		if err := fs.Chown(file, int(stat.Uid), int(stat.Gid)); err != nil {
+			return fmt.Errorf("unable to chown %s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// processExists reports whether a process with pid exists by sending it the
+// null signal. EPERM means it exists but belongs to another user.
+func processExists(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// syncDir fsyncs the directory dir, making renames into it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil && !isSyncUnsupported(err) {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+// checkDirWritable returns an error if the current user cannot create files in
+// dir.
+func checkDirWritable(dir string) error {
+	return unix.Access(dir, unix.W_OK)
+}
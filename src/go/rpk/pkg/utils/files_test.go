@@ -10,7 +10,17 @@
 package utils_test
 
 import (
+	"crypto/md5"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
 	"github.com/spf13/afero"
@@ -22,6 +32,7 @@ func TestWriteBytes(t *testing.T) {
 	content := "redpanda:\nsome_field: somevalue"
 	bs := []byte(content)
 	filepath := "/tmp/testwritebytes.yaml"
+	require.NoError(t, fs.MkdirAll("/tmp", 0o755))
 
 	n, err := utils.WriteBytes(fs, bs, filepath)
 	require.Equal(t, len(bs), n, "the number of bytes read doesn't match the number of bytes written")
@@ -33,3 +44,1703 @@ func TestWriteBytes(t *testing.T) {
 	require.NoError(t, err)
 	require.Exactly(t, bs, buf)
 }
+
+func TestWriteFileLinesWithHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []string
+		lines  []string
+		exp    string
+	}{
+		{
+			name:   "header and body",
+			header: []string{"# DO NOT EDIT"},
+			lines:  []string{"a", "b"},
+			exp:    "# DO NOT EDIT\n\na\nb\n",
+		},
+		{
+			name:   "blank lines collapse to one separator",
+			header: []string{"# DO NOT EDIT", "", ""},
+			lines:  []string{"", "a"},
+			exp:    "# DO NOT EDIT\n\na\n",
+		},
+		{
+			name:  "no header",
+			lines: []string{"a"},
+			exp:   "a\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			path := "/etc/redpanda/generated.conf"
+			err := utils.WriteFileLinesWithHeader(fs, tt.lines, path, tt.header)
+			require.NoError(t, err)
+			bs, err := afero.ReadFile(fs, path)
+			require.NoError(t, err)
+			require.Equal(t, tt.exp, string(bs))
+			info, err := fs.Stat(path)
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+			files, err := afero.ReadDir(fs, "/etc/redpanda")
+			require.NoError(t, err)
+			require.Len(t, files, 1, "temporary file was left behind")
+		})
+	}
+}
+
+func TestCountLinesByPrefix(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	content := "cluster.id: 1\nbroker.a: 2\ncluster.name: x\n# comment\n" + strings.Repeat("x", 100*1024) + "\n"
+	require.NoError(t, afero.WriteFile(fs, "/cfg", []byte(content), 0o644))
+
+	counts, err := utils.CountLinesByPrefix(fs, "/cfg", []string{"cluster.", "broker.", "node."})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{
+		"cluster.":        2,
+		"broker.":         1,
+		"node.":           0,
+		utils.OtherPrefix: 2,
+	}, counts)
+
+	_, err = utils.CountLinesByPrefix(fs, "/cfg", []string{"cluster.", utils.OtherPrefix})
+	require.Error(t, err)
+
+	_, err = utils.CountLinesByPrefix(fs, "/missing", nil)
+	require.Error(t, err)
+}
+
+func TestResolveSymlink(t *testing.T) {
+	fs := afero.NewOsFs()
+	root := t.TempDir()
+	data := filepath.Join(root, "data")
+	require.NoError(t, fs.MkdirAll(data, 0o755))
+	target := filepath.Join(data, "segment")
+	require.NoError(t, afero.WriteFile(fs, target, []byte("x"), 0o644))
+
+	inside := filepath.Join(root, "inside")
+	require.NoError(t, os.Symlink("data/segment", inside))
+	outside := filepath.Join(root, "outside")
+	require.NoError(t, os.Symlink("/etc/passwd", outside))
+
+	got, err := utils.ResolveSymlink(fs, inside, data)
+	require.NoError(t, err)
+	require.Equal(t, target, got)
+
+	_, err = utils.ResolveSymlink(fs, outside, data)
+	require.Error(t, err)
+
+	got, err = utils.ResolveSymlink(fs, target, data)
+	require.NoError(t, err)
+	require.Equal(t, target, got)
+
+	got, err = utils.ResolveSymlink(afero.NewMemMapFs(), "/not/a/link", data)
+	require.Error(t, err, "missing path should error")
+	require.Empty(t, got)
+}
+
+func TestResolveSymlinkChain(t *testing.T) {
+	fs := afero.NewOsFs()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	secret := filepath.Join(dir, "outside", "secret")
+	require.NoError(t, fs.MkdirAll(filepath.Join(root, "data"), 0o755))
+	require.NoError(t, fs.MkdirAll(filepath.Dir(secret), 0o755))
+	require.NoError(t, afero.WriteFile(fs, secret, []byte("x"), 0o644))
+	target := filepath.Join(root, "data", "segment")
+	require.NoError(t, afero.WriteFile(fs, target, []byte("x"), 0o644))
+
+	// root/a -> root/b -> outside/secret
+	require.NoError(t, os.Symlink(secret, filepath.Join(root, "b")))
+	require.NoError(t, os.Symlink("b", filepath.Join(root, "a")))
+	_, err := utils.ResolveSymlink(fs, filepath.Join(root, "a"), root)
+	require.Error(t, err)
+
+	// root/c -> root/d -> root/data/segment
+	require.NoError(t, os.Symlink("data/segment", filepath.Join(root, "d")))
+	require.NoError(t, os.Symlink("d", filepath.Join(root, "c")))
+	got, err := utils.ResolveSymlink(fs, filepath.Join(root, "c"), root)
+	require.NoError(t, err)
+	require.Equal(t, target, got)
+
+	// A symlinked parent directory is resolved too.
+	require.NoError(t, os.Symlink(filepath.Dir(secret), filepath.Join(root, "escape")))
+	_, err = utils.ResolveSymlink(fs, filepath.Join(root, "escape", "secret"), root)
+	require.Error(t, err)
+}
+
+func TestCopyFilesAtomic(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/src/a", []byte("a"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/b", []byte("b"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/dst/a", []byte("old a"), 0o644))
+	require.NoError(t, fs.MkdirAll("/dst", 0o755))
+
+	err := utils.CopyFilesAtomic(fs, map[string]string{
+		"/src/a":       "/dst/a",
+		"/src/b":       "/dst/b",
+		"/src/missing": "/dst/c",
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "/src/missing")
+	bs, err := afero.ReadFile(fs, "/dst/a")
+	require.NoError(t, err)
+	require.Equal(t, "old a", string(bs))
+	files, err := afero.ReadDir(fs, "/dst")
+	require.NoError(t, err)
+	require.Len(t, files, 1, "temporary files were left behind")
+
+	err = utils.CopyFilesAtomic(fs, map[string]string{
+		"/src/a": "/dst/a",
+		"/src/b": "/dst/b",
+	})
+	require.NoError(t, err)
+	for _, name := range []string{"a", "b"} {
+		bs, err := afero.ReadFile(fs, "/dst/"+name)
+		require.NoError(t, err)
+		require.Equal(t, name, string(bs))
+	}
+}
+
+func TestDedupContiguousLines(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := "/var/log/rpk.log"
+	require.NoError(t, afero.WriteFile(fs, path, []byte("a\na\na\nb\na\nc\nc\n"), 0o640))
+
+	removed, err := utils.DedupContiguousLines(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, 3, removed)
+	bs, err := afero.ReadFile(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, "a\nb\na\nc\n", string(bs))
+	info, err := fs.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	removed, err = utils.DedupContiguousLines(fs, path)
+	require.NoError(t, err)
+	require.Zero(t, removed)
+}
+
+func TestWriteFileLinesLimited(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := "/gen.conf"
+	lines := []string{"abc", "de"} // "abc\nde\n" is 7 bytes.
+
+	err := utils.WriteFileLinesLimited(fs, lines, path, 6)
+	require.Error(t, err)
+	exists, err := afero.Exists(fs, path)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, utils.WriteFileLinesLimited(fs, lines, path, 7))
+	bs, err := afero.ReadFile(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, "abc\nde\n", string(bs))
+}
+
+func TestAppendWithRotation(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := "/var/log/rpk.log"
+	read := func(p string) string {
+		bs, err := afero.ReadFile(fs, p)
+		require.NoError(t, err)
+		return string(bs)
+	}
+
+	// Each entry is 4 bytes, so two fit in a file before rotating.
+	for _, line := range []string{"aaa", "bbb", "ccc", "ddd", "eee", "fff", "ggg"} {
+		require.NoError(t, utils.AppendWithRotation(fs, line, path, 8, 2))
+	}
+	require.Equal(t, "ggg\n", read(path))
+	require.Equal(t, "eee\nfff\n", read(path+".1"))
+	require.Equal(t, "ccc\nddd\n", read(path+".2"))
+	exists, err := afero.Exists(fs, path+".3")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestDeleteMatching(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, f := range []string{"/etc/a.bk", "/etc/b.bk", "/etc/c.yaml", "/etc/sub/d.bk"} {
+		require.NoError(t, afero.WriteFile(fs, f, nil, 0o644))
+	}
+	require.NoError(t, fs.MkdirAll("/etc/dir.bk", 0o755))
+
+	n, err := utils.DeleteMatching(fs, "/etc/*.bk")
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	for f, exp := range map[string]bool{
+		"/etc/a.bk":     false,
+		"/etc/b.bk":     false,
+		"/etc/c.yaml":   true,
+		"/etc/sub/d.bk": true,
+		"/etc/dir.bk":   true,
+	} {
+		exists, err := afero.Exists(fs, f)
+		require.NoError(t, err)
+		require.Equal(t, exp, exists, f)
+	}
+
+	_, err = utils.DeleteMatching(fs, "/etc/[")
+	require.ErrorIs(t, err, filepath.ErrBadPattern)
+}
+
+func TestEnsureFileContent(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := "/etc/redpanda/token"
+	check := func(expContent string, expMode os.FileMode) {
+		bs, err := afero.ReadFile(fs, path)
+		require.NoError(t, err)
+		require.Equal(t, expContent, string(bs))
+		info, err := fs.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, expMode, info.Mode().Perm())
+	}
+
+	changed, err := utils.EnsureFileContent(fs, path, []byte("abc"), 0o600)
+	require.NoError(t, err)
+	require.True(t, changed, "missing file should be created")
+	check("abc", 0o600)
+
+	changed, err = utils.EnsureFileContent(fs, path, []byte("abc"), 0o600)
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	changed, err = utils.EnsureFileContent(fs, path, []byte("abc"), 0o640)
+	require.NoError(t, err)
+	require.True(t, changed, "mode drift should be fixed")
+	check("abc", 0o640)
+
+	changed, err = utils.EnsureFileContent(fs, path, []byte("xyz"), 0o640)
+	require.NoError(t, err)
+	require.True(t, changed, "content drift should be fixed")
+	check("xyz", 0o640)
+}
+
+func TestReadLogicalLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		exp     []string
+	}{
+		{
+			name:    "no continuations",
+			content: "a\nb\n",
+			exp:     []string{"a", "b"},
+		},
+		{
+			name:    "joined lines",
+			content: "a \\\nb \\\nc\nd\n",
+			exp:     []string{"a b c", "d"},
+		},
+		{
+			name:    "escaped backslash is literal",
+			content: "a\\\\\nb\n",
+			exp:     []string{`a\\`, "b"},
+		},
+		{
+			name:    "continuation at EOF",
+			content: "a\nb\\",
+			exp:     []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(fs, "/f", []byte(tt.content), 0o644))
+			lines, err := utils.ReadLogicalLines(fs, "/f")
+			require.NoError(t, err)
+			require.Equal(t, tt.exp, lines)
+		})
+	}
+}
+
+func TestStatAll(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/etc/redpanda/redpanda.yaml", []byte("abc"), 0o644))
+	require.NoError(t, fs.MkdirAll("/var/lib/redpanda", 0o755))
+
+	metas, errs := utils.StatAll(fs, []string{
+		"/etc/redpanda/redpanda.yaml",
+		"/missing/one",
+		"/var/lib/redpanda",
+		"/missing/two",
+	})
+	require.Len(t, metas, 2)
+	require.Equal(t, int64(3), metas["/etc/redpanda/redpanda.yaml"].Size)
+	require.False(t, metas["/etc/redpanda/redpanda.yaml"].IsDir)
+	require.True(t, metas["/var/lib/redpanda"].IsDir)
+	require.Len(t, errs, 2)
+	require.True(t, os.IsNotExist(errs["/missing/one"]))
+	require.True(t, os.IsNotExist(errs["/missing/two"]))
+}
+
+func TestReadSingleValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		exp     string
+		expErr  bool
+	}{
+		{name: "single line", content: "1234", exp: "1234"},
+		{name: "trailing blank lines", content: " 1234 \n\n  \n", exp: "1234"},
+		{name: "empty", content: "", expErr: true},
+		{name: "only blank lines", content: "\n \n", expErr: true},
+		{name: "multiple values", content: "1234\n5678\n", expErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(fs, "/pid", []byte(tt.content), 0o644))
+			v, err := utils.ReadSingleValue(fs, "/pid")
+			if tt.expErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.exp, v)
+		})
+	}
+}
+
+func TestCheckFileMode(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/token", nil, 0o644))
+
+	ok, actual, err := utils.CheckFileMode(fs, "/token", 0o600)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, os.FileMode(0o644), actual)
+
+	ok, _, err = utils.CheckFileMode(fs, "/token", 0o644)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, _, err = utils.CheckFileMode(fs, "/missing", 0o600)
+	require.Error(t, err)
+}
+
+func TestMkdirTemp(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, fs.MkdirAll("/var/lib/redpanda", 0o755))
+
+	dir, cleanup, err := utils.MkdirTemp(fs, "/var/lib/redpanda", "staging-")
+	require.NoError(t, err)
+	require.Equal(t, "/var/lib/redpanda", filepath.Dir(dir))
+	require.True(t, strings.HasPrefix(filepath.Base(dir), "staging-"))
+	require.NoError(t, afero.WriteFile(fs, filepath.Join(dir, "sub", "file"), []byte("x"), 0o644))
+
+	other, otherCleanup, err := utils.MkdirTemp(fs, "/var/lib/redpanda", "staging-")
+	require.NoError(t, err)
+	require.NotEqual(t, dir, other)
+	require.NoError(t, otherCleanup())
+
+	require.NoError(t, cleanup())
+	require.NoError(t, cleanup())
+	exists, err := afero.DirExists(fs, dir)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestReadFileLinesUntil(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/doc", []byte("title: x\ndate: y\n---\nbody\n---\n"), 0o644))
+	isMarker := func(line string) bool { return line == "---" }
+
+	lines, err := utils.ReadFileLinesUntil(fs, "/doc", isMarker)
+	require.NoError(t, err)
+	require.Equal(t, []string{"title: x", "date: y"}, lines)
+
+	lines, err = utils.ReadFileLinesUntil(fs, "/doc", func(string) bool { return false })
+	require.NoError(t, err)
+	require.Equal(t, []string{"title: x", "date: y", "---", "body", "---"}, lines)
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		exp     bool
+	}{
+		{name: "empty", content: nil, exp: false},
+		{name: "text", content: []byte("redpanda:\n\tdata_directory: /var/lib/redpanda\r\n"), exp: false},
+		{name: "utf-8 text", content: []byte("héllo wörld ✓\n"), exp: false},
+		{name: "nul byte", content: []byte("ELF\x00\x01"), exp: true},
+		{name: "mostly control bytes", content: []byte("\x01\x02\x03\x04abc"), exp: true},
+		{name: "few control bytes", content: []byte("some text with a \x07 bell"), exp: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(fs, "/f", tt.content, 0o644))
+			got, err := utils.IsBinary(fs, "/f")
+			require.NoError(t, err)
+			require.Equal(t, tt.exp, got)
+		})
+	}
+}
+
+func TestReadFileLinesFrom(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := "/var/log/redpanda.log"
+	require.NoError(t, afero.WriteFile(fs, path, []byte("one\ntwo\r\nthr"), 0o644))
+
+	lines, offset, err := utils.ReadFileLinesFrom(fs, path, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"one", "two"}, lines)
+	require.Equal(t, int64(9), offset)
+
+	lines, again, err := utils.ReadFileLinesFrom(fs, path, offset)
+	require.NoError(t, err)
+	require.Empty(t, lines)
+	require.Equal(t, offset, again)
+
+	f, err := fs.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString("ee\nfour\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	lines, offset, err = utils.ReadFileLinesFrom(fs, path, offset)
+	require.NoError(t, err)
+	require.Equal(t, []string{"three", "four"}, lines)
+	require.Equal(t, int64(20), offset)
+
+	require.NoError(t, afero.WriteFile(fs, path, []byte("rotated\n"), 0o644))
+	_, got, err := utils.ReadFileLinesFrom(fs, path, offset)
+	require.ErrorIs(t, err, utils.ErrOffsetPastEOF)
+	require.Equal(t, offset, got)
+	lines, offset, err = utils.ReadFileLinesFrom(fs, path, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"rotated"}, lines)
+	require.Equal(t, int64(8), offset)
+}
+
+func TestWriteSync(t *testing.T) {
+	dir := t.TempDir()
+	for name, test := range map[string]struct {
+		fs  afero.Fs
+		dir string
+	}{
+		"mem":       {afero.NewMemMapFs(), "/"},
+		"os":        {afero.NewOsFs(), dir},
+		"base path": {afero.NewBasePathFs(afero.NewOsFs(), t.TempDir()), "/"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fs := test.fs
+			lines, bytesPath := filepath.Join(test.dir, "lines"), filepath.Join(test.dir, "bytes")
+			require.NoError(t, utils.WriteFileLinesSync(fs, []string{"old"}, lines))
+			require.NoError(t, utils.WriteFileLinesSync(fs, []string{"a", "b"}, lines))
+			bs, err := afero.ReadFile(fs, lines)
+			require.NoError(t, err)
+			require.Equal(t, "a\nb\n", string(bs))
+
+			n, err := utils.WriteBytesSync(fs, []byte("abc"), bytesPath)
+			require.NoError(t, err)
+			require.Equal(t, 3, n)
+			bs, err = afero.ReadFile(fs, bytesPath)
+			require.NoError(t, err)
+			require.Equal(t, "abc", string(bs))
+			info, err := fs.Stat(bytesPath)
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+			infos, err := afero.ReadDir(fs, test.dir)
+			require.NoError(t, err)
+			require.Len(t, infos, 2, "no temporary file should be left behind")
+		})
+	}
+}
+
+func TestReadTrimmedString(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/token", []byte("\n  line one\nline two \n\n"), 0o600))
+
+	s, err := utils.ReadTrimmedString(fs, "/token")
+	require.NoError(t, err)
+	require.Equal(t, "line one\nline two", s)
+
+	_, err = utils.ReadTrimmedString(fs, "/missing")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "/missing")
+}
+
+func TestListDirsAndRegularFilesInPath(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, fs.MkdirAll("/data/kafka/foo/0_1", 0o755))
+	require.NoError(t, fs.MkdirAll("/data/kafka/foo/1_1", 0o755))
+	require.NoError(t, afero.WriteFile(fs, "/data/kafka/foo/meta", nil, 0o644))
+
+	dirs, err := utils.ListDirsInPath(fs, "/data/kafka/foo")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"0_1", "1_1"}, dirs)
+
+	files, err := utils.ListRegularFilesInPath(fs, "/data/kafka/foo")
+	require.NoError(t, err)
+	require.Equal(t, []string{"meta"}, files)
+
+	_, err = utils.ListDirsInPath(fs, "/missing")
+	require.Error(t, err)
+	_, err = utils.ListRegularFilesInPath(fs, "/missing")
+	require.Error(t, err)
+}
+
+func TestFilesByModTime(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	old := time.Now().Add(-48 * time.Hour)
+	for path, mtime := range map[string]time.Time{
+		"/bundles/old.zip":          old,
+		"/bundles/new.zip":          time.Now(),
+		"/bundles/archive/old2.zip": old,
+		"/bundles/archive/new2.zip": time.Now(),
+	} {
+		require.NoError(t, afero.WriteFile(fs, path, nil, 0o644))
+		require.NoError(t, fs.Chtimes(path, mtime, mtime))
+	}
+
+	paths, err := utils.FilesOlderThan(fs, "/bundles", 24*time.Hour, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"old.zip"}, paths)
+
+	paths, err = utils.FilesOlderThan(fs, "/bundles", 24*time.Hour, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"archive/old2.zip", "old.zip"}, paths)
+
+	paths, err = utils.FilesNewerThan(fs, "/bundles", 24*time.Hour, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"archive/new2.zip", "new.zip"}, paths)
+
+	_, err = utils.FilesOlderThan(fs, "/missing", time.Hour, true)
+	require.Error(t, err)
+}
+
+func TestReadFileLinesNumbered(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/f", []byte("a\n\nc\n"), 0o644))
+
+	lines, err := utils.ReadFileLinesNumbered(fs, "/f")
+	require.NoError(t, err)
+	require.Equal(t, []utils.NumberedLine{
+		{Number: 1, Text: "a"},
+		{Number: 2, Text: ""},
+		{Number: 3, Text: "c"},
+	}, lines)
+}
+
+func TestReadFirstExisting(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/etc/redpanda/redpanda.yaml", []byte("etc"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/home/rp/redpanda.yaml", []byte("home"), 0o644))
+
+	path, content, err := utils.ReadFirstExisting(fs, []string{
+		"/cwd/redpanda.yaml",
+		"/etc/redpanda/redpanda.yaml",
+		"/home/rp/redpanda.yaml",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "/etc/redpanda/redpanda.yaml", path)
+	require.Equal(t, "etc", string(content))
+
+	_, _, err = utils.ReadFirstExisting(fs, []string{"/a", "/b"})
+	require.ErrorIs(t, err, utils.ErrNoneExist)
+
+	_, _, err = utils.ReadFirstExisting(&failingOpenFs{fs, "/etc/redpanda/redpanda.yaml"}, []string{
+		"/etc/redpanda/redpanda.yaml",
+		"/home/rp/redpanda.yaml",
+	})
+	require.ErrorIs(t, err, os.ErrPermission)
+}
+
+// failingOpenFs fails to open path with a permission error.
+type failingOpenFs struct {
+	afero.Fs
+	path string
+}
+
+func (f *failingOpenFs) Open(name string) (afero.File, error) {
+	if name == f.path {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	return f.Fs.Open(name)
+}
+
+func TestReplaceFilePreservingMeta(t *testing.T) {
+	for name, fs := range map[string]afero.Fs{
+		"mem": afero.NewMemMapFs(),
+		"os":  afero.NewBasePathFs(afero.NewOsFs(), t.TempDir()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, utils.ReplaceFilePreservingMeta(fs, "/new", []byte("a")))
+			info, err := fs.Stat("/new")
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+			require.NoError(t, afero.WriteFile(fs, "/existing", []byte("old"), 0o640))
+			require.NoError(t, fs.Chmod("/existing", 0o640))
+			require.NoError(t, utils.ReplaceFilePreservingMeta(fs, "/existing", []byte("new")))
+			bs, err := afero.ReadFile(fs, "/existing")
+			require.NoError(t, err)
+			require.Equal(t, "new", string(bs))
+			info, err = fs.Stat("/existing")
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+		})
+	}
+}
+
+func TestMergeSortedFiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/a", []byte("apple\ncherry\ncherry\nfig\n"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/b", []byte("banana\ncherry\ngrape\n"), 0o644))
+
+	require.NoError(t, utils.MergeSortedFiles(fs, "/a", "/b", "/merged", false))
+	bs, err := afero.ReadFile(fs, "/merged")
+	require.NoError(t, err)
+	require.Equal(t, "apple\nbanana\ncherry\ncherry\ncherry\nfig\ngrape\n", string(bs))
+
+	require.NoError(t, utils.MergeSortedFiles(fs, "/a", "/b", "/merged", true))
+	bs, err = afero.ReadFile(fs, "/merged")
+	require.NoError(t, err)
+	require.Equal(t, "apple\nbanana\ncherry\nfig\ngrape\n", string(bs))
+
+	require.Error(t, utils.MergeSortedFiles(fs, "/a", "/missing", "/merged", true))
+}
+
+func TestForEachLineIndexed(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/f", []byte("1\n2\nx\n4\n"), 0o644))
+
+	var seen []int
+	errBad := errors.New("not a number")
+	err := utils.ForEachLineIndexed(fs, "/f", func(n int, line string) error {
+		seen = append(seen, n)
+		if line == "x" {
+			return errBad
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errBad)
+	require.EqualError(t, err, "at line 3: not a number")
+	require.Equal(t, []int{1, 2, 3}, seen)
+}
+
+func TestLinesDiffCount(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/f", []byte("a\nb\nc\nd\n"), 0o644))
+
+	tests := []struct {
+		name       string
+		path       string
+		lines      []string
+		expAdded   int
+		expRemoved int
+	}{
+		{name: "unchanged", path: "/f", lines: []string{"a", "b", "c", "d"}},
+		{name: "one changed", path: "/f", lines: []string{"a", "x", "c", "d"}, expAdded: 1, expRemoved: 1},
+		{name: "appended", path: "/f", lines: []string{"a", "b", "c", "d", "e"}, expAdded: 1},
+		{name: "removed", path: "/f", lines: []string{"b", "d"}, expRemoved: 2},
+		{name: "reordered", path: "/f", lines: []string{"d", "a", "b", "c"}, expAdded: 1, expRemoved: 1},
+		{name: "missing file", path: "/missing", lines: []string{"a", "b"}, expAdded: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed, err := utils.LinesDiffCount(fs, tt.path, tt.lines)
+			require.NoError(t, err)
+			require.Equal(t, tt.expAdded, added, "added")
+			require.Equal(t, tt.expRemoved, removed, "removed")
+		})
+	}
+}
+
+func TestWriteFileLinesBackup(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := "/etc/sysctl.conf"
+
+	bk, err := utils.WriteFileLinesBackup(fs, []string{"first"}, path)
+	require.NoError(t, err)
+	require.Empty(t, bk)
+
+	bk, err = utils.WriteFileLinesBackup(fs, []string{"second"}, path)
+	require.NoError(t, err)
+	require.NotEmpty(t, bk)
+	bs, err := afero.ReadFile(fs, bk)
+	require.NoError(t, err)
+	require.Equal(t, "first\n", string(bs))
+	bs, err = afero.ReadFile(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, "second\n", string(bs))
+}
+
+func TestForEachLineChunk(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/f", []byte("1\n2\n3\n4\n5\n"), 0o644))
+
+	var chunks [][]string
+	err := utils.ForEachLineChunk(fs, "/f", 2, func(lines []string) error {
+		chunks = append(chunks, append([]string(nil), lines...))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"1", "2"}, {"3", "4"}, {"5"}}, chunks)
+
+	calls := 0
+	errStop := errors.New("stop")
+	err = utils.ForEachLineChunk(fs, "/f", 2, func([]string) error {
+		calls++
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, 1, calls)
+
+	require.Error(t, utils.ForEachLineChunk(fs, "/f", 0, func([]string) error { return nil }))
+}
+
+func TestRemoveIfHashMatches(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/cache/entry", []byte("redpanda"), 0o644))
+	sum, err := utils.FileMd5(fs, "/cache/entry")
+	require.NoError(t, err)
+
+	err = utils.RemoveIfHashMatches(fs, "/cache/entry", "d41d8cd98f00b204e9800998ecf8427e", md5.New())
+	require.ErrorIs(t, err, utils.ErrHashMismatch)
+	exists, err := afero.Exists(fs, "/cache/entry")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	require.NoError(t, utils.RemoveIfHashMatches(fs, "/cache/entry", sum, md5.New()))
+	exists, err = afero.Exists(fs, "/cache/entry")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestCopyFileWithHash(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/src", []byte("redpanda"), 0o600))
+
+	sum, err := utils.CopyFileWithHash(fs, "/src", "/dst", md5.New())
+	require.NoError(t, err)
+	exp, err := utils.FileMd5(fs, "/dst")
+	require.NoError(t, err)
+	require.Equal(t, exp, sum)
+	info, err := fs.Stat("/dst")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+
+	_, err = utils.CopyFileWithHash(fs, "/missing", "/dst2", md5.New())
+	require.Error(t, err)
+}
+
+func TestCopyFileWithHashSameFile(t *testing.T) {
+	dir := t.TempDir()
+	fs := afero.NewOsFs()
+	src := filepath.Join(dir, "a.conf")
+	require.NoError(t, afero.WriteFile(fs, src, []byte("a=1\n"), 0o644))
+	require.NoError(t, os.Symlink(src, filepath.Join(dir, "link")))
+
+	for _, dst := range []string{src, filepath.Join(dir, "link")} {
+		_, err := utils.CopyFileWithHash(fs, src, dst, md5.New())
+		require.Error(t, err, dst)
+		bs, err := afero.ReadFile(fs, src)
+		require.NoError(t, err)
+		require.Equal(t, "a=1\n", string(bs))
+	}
+}
+
+func TestCopyFileWithHashFailedCopy(t *testing.T) {
+	dir := t.TempDir()
+	fs := afero.NewOsFs()
+	// Opening a directory succeeds but reading it fails, failing the copy.
+	src := filepath.Join(dir, "src")
+	require.NoError(t, fs.Mkdir(src, 0o755))
+
+	dst := filepath.Join(dir, "dst")
+	_, err := utils.CopyFileWithHash(fs, src, dst, md5.New())
+	require.Error(t, err)
+	_, err = fs.Stat(dst)
+	require.True(t, os.IsNotExist(err))
+	entries, err := afero.ReadDir(fs, dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestReadGlob(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/conf/a.yaml", []byte("a"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/conf/b.yaml", []byte("b"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/conf/c.txt", []byte("c"), 0o644))
+	require.NoError(t, fs.MkdirAll("/conf/d.yaml", 0o755))
+
+	contents, err := utils.ReadGlob(fs, "/conf/*.yaml")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{
+		"/conf/a.yaml": []byte("a"),
+		"/conf/b.yaml": []byte("b"),
+	}, contents)
+
+	_, err = utils.ReadGlob(fs, "/conf/[")
+	require.ErrorIs(t, err, filepath.ErrBadPattern)
+}
+
+func TestValidateWritablePath(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, fs.MkdirAll("/etc/redpanda", 0o755))
+	require.NoError(t, fs.MkdirAll("/readonly", 0o555))
+	require.NoError(t, afero.WriteFile(fs, "/etc/redpanda/redpanda.yaml", nil, 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/readonly/existing", nil, 0o644))
+
+	tests := []struct {
+		name   string
+		path   string
+		expErr string
+	}{
+		{name: "new file", path: "/etc/redpanda/new.yaml"},
+		{name: "existing file", path: "/etc/redpanda/redpanda.yaml"},
+		{name: "existing file in read-only dir", path: "/readonly/existing"},
+		{name: "missing parent", path: "/missing/file", expErr: "parent directory /missing does not exist"},
+		{name: "parent is a file", path: "/etc/redpanda/redpanda.yaml/file", expErr: "is not a directory"},
+		{name: "path is a directory", path: "/etc/redpanda", expErr: "path is a directory"},
+		// Only OsFs can tell whether a directory is writable.
+		{name: "new file in read-only dir", path: "/readonly/new"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := utils.ValidateWritablePath(fs, tt.path)
+			if tt.expErr != "" {
+				require.ErrorContains(t, err, tt.expErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	err := utils.WriteFileLines(fs, []string{"a"}, "/etc/redpanda")
+	require.ErrorContains(t, err, "path is a directory")
+	_, err = utils.WriteBytes(fs, []byte("a"), "/missing/file")
+	require.ErrorContains(t, err, "does not exist")
+}
+
+func TestValidateWritablePathOs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory writability is not checked on Windows")
+	}
+	fs := afero.NewOsFs()
+	dir := t.TempDir()
+	readonly := filepath.Join(dir, "readonly")
+	require.NoError(t, fs.Mkdir(readonly, 0o555))
+	t.Cleanup(func() { os.Chmod(readonly, 0o755) })
+
+	require.NoError(t, utils.ValidateWritablePath(fs, filepath.Join(dir, "new")))
+
+	// The mode bits alone do not decide: root can write to a 0o555
+	// directory, while anyone else cannot.
+	err := utils.ValidateWritablePath(fs, filepath.Join(readonly, "new"))
+	if os.Geteuid() == 0 {
+		require.NoError(t, err)
+	} else {
+		require.ErrorContains(t, err, "is not writable")
+	}
+}
+
+func TestReadLinesSet(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/allow", []byte("alice\n bob \n\nalice\n"), 0o644))
+
+	set, err := utils.ReadLinesSet(fs, "/allow", true, true)
+	require.NoError(t, err)
+	require.Equal(t, map[string]struct{}{"alice": {}, "bob": {}}, set)
+
+	set, err = utils.ReadLinesSet(fs, "/allow", false, false)
+	require.NoError(t, err)
+	require.Equal(t, map[string]struct{}{"alice": {}, " bob ": {}, "": {}}, set)
+}
+
+func TestReadFileLinesDeadline(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/f", []byte("a\nb\n"), 0o644))
+
+	lines, err := utils.ReadFileLinesDeadline(fs, "/f", time.Second)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, lines)
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+	_, err = utils.ReadFileLinesDeadline(&blockingOpenFs{fs, unblock}, "/f", 10*time.Millisecond)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+// blockingOpenFs blocks every Open until unblock is closed.
+type blockingOpenFs struct {
+	afero.Fs
+	unblock chan struct{}
+}
+
+func (b *blockingOpenFs) Open(name string) (afero.File, error) {
+	<-b.unblock
+	return b.Fs.Open(name)
+}
+
+func TestEnsureLinePresent(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := "/etc/includes.conf"
+	read := func() string {
+		bs, err := afero.ReadFile(fs, path)
+		require.NoError(t, err)
+		return string(bs)
+	}
+
+	added, err := utils.EnsureLinePresent(fs, path, "include a")
+	require.NoError(t, err)
+	require.True(t, added)
+	require.Equal(t, "include a\n", read())
+
+	added, err = utils.EnsureLinePresent(fs, path, "include a")
+	require.NoError(t, err)
+	require.False(t, added)
+	require.Equal(t, "include a\n", read())
+
+	require.NoError(t, afero.WriteFile(fs, path, []byte("include a\ninclude b"), 0o644))
+	added, err = utils.EnsureLinePresent(fs, path, "include c")
+	require.NoError(t, err)
+	require.True(t, added)
+	require.Equal(t, "include a\ninclude b\ninclude c\n", read())
+
+	added, err = utils.EnsureLinePresent(fs, path, "include")
+	require.NoError(t, err)
+	require.True(t, added, "only exact matches count")
+}
+
+func TestSetKeyLine(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := "/etc/default/irqbalance"
+	require.NoError(t, afero.WriteFile(fs, path, []byte("# comment\n  ONE_SHOT = true\nBANNED=1\n"), 0o640))
+	read := func() string {
+		bs, err := afero.ReadFile(fs, path)
+		require.NoError(t, err)
+		return string(bs)
+	}
+
+	replaced, err := utils.SetKeyLine(fs, path, "ONE_SHOT", "false", " = ")
+	require.NoError(t, err)
+	require.True(t, replaced)
+	require.Equal(t, "# comment\nONE_SHOT = false\nBANNED=1\n", read())
+
+	replaced, err = utils.SetKeyLine(fs, path, "ARGS", "--foo", "=")
+	require.NoError(t, err)
+	require.False(t, replaced)
+	require.Equal(t, "# comment\nONE_SHOT = false\nBANNED=1\nARGS=--foo\n", read())
+	info, err := fs.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	replaced, err = utils.SetKeyLine(fs, "/new.conf", "a", "b", "=")
+	require.NoError(t, err)
+	require.False(t, replaced)
+	bs, err := afero.ReadFile(fs, "/new.conf")
+	require.NoError(t, err)
+	require.Equal(t, "a=b\n", string(bs))
+
+	// Keys match as KVDoc parses them: spaces around sep are allowed, and
+	// commented-out keys and keys that only share a prefix are not matches.
+	require.NoError(t, afero.WriteFile(fs, "/spaced.conf", []byte("#foo=1\nfoobar=1\nfoo = 2\n"), 0o644))
+	replaced, err = utils.SetKeyLine(fs, "/spaced.conf", "foo", "3", "=")
+	require.NoError(t, err)
+	require.True(t, replaced)
+	bs, err = afero.ReadFile(fs, "/spaced.conf")
+	require.NoError(t, err)
+	require.Equal(t, "#foo=1\nfoobar=1\nfoo=3\n", string(bs))
+	kvs, err := utils.ReadKeyValueFile(fs, "/spaced.conf", "=")
+	require.NoError(t, err)
+	require.Equal(t, "3", kvs["foo"])
+
+	// Line terminators and the lack of a final newline are preserved.
+	for _, test := range []struct {
+		content, key, exp string
+	}{
+		{"# c\r\na=1\r\nb=2", "a", "# c\r\na=9\r\nb=2"},
+		{"# c\r\na=1\r\nb=2", "b", "# c\r\na=1\r\nb=9"},
+		{"# c\r\na=1\r\nb=2", "z", "# c\r\na=1\r\nb=2\r\nz=9"},
+		{"# c\r\na=1\r\n", "z", "# c\r\na=1\r\nz=9\r\n"},
+		{"a=1", "z", "a=1\nz=9"},
+		{"", "z", "z=9\n"},
+	} {
+		require.NoError(t, afero.WriteFile(fs, path, []byte(test.content), 0o640))
+		_, err := utils.SetKeyLine(fs, path, test.key, "9", "=")
+		require.NoError(t, err)
+		require.Equal(t, test.exp, read(), "setting %s in %q", test.key, test.content)
+	}
+}
+
+func TestRemoveAllUnder(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/var/lib/redpanda/data/a/b", nil, 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/var/lib/redpanda/datadir/c", nil, 0o644))
+	root := "/var/lib/redpanda/data"
+
+	for _, path := range []string{
+		"",
+		"/",
+		root,
+		root + "/",
+		root + "/a/../..",
+		"/var/lib/redpanda/datadir",
+	} {
+		require.Error(t, utils.RemoveAllUnder(fs, path, root), "path %q", path)
+	}
+	exists, err := afero.Exists(fs, "/var/lib/redpanda/datadir/c")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	require.NoError(t, utils.RemoveAllUnder(fs, root+"/a", root))
+	exists, err = afero.Exists(fs, root+"/a")
+	require.NoError(t, err)
+	require.False(t, exists)
+	exists, err = afero.DirExists(fs, root)
+	require.NoError(t, err)
+	require.True(t, exists)
+}
+
+func TestWriteWrappedLines(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	lines := []string{
+		"short line",
+		"",
+		"the quick brown fox jumps over the lazy dog",
+		"a supercalifragilisticexpialidocious word",
+	}
+	require.NoError(t, utils.WriteWrappedLines(fs, lines, "/doc.txt", 15))
+	bs, err := afero.ReadFile(fs, "/doc.txt")
+	require.NoError(t, err)
+	require.Equal(t, "short line\n\nthe quick brown\nfox jumps over\nthe lazy dog\na\nsupercalifragilisticexpialidocious\nword\n", string(bs))
+
+	require.Error(t, utils.WriteWrappedLines(fs, lines, "/doc.txt", 0))
+
+	lines = []string{"a", strings.Repeat(" ", 20), "b", "    indented words wrap here"}
+	require.NoError(t, utils.WriteWrappedLines(fs, lines, "/doc.txt", 10))
+	bs, err = afero.ReadFile(fs, "/doc.txt")
+	require.NoError(t, err)
+	require.Equal(t, "a\n\nb\n    indented\nwords wrap\nhere\n", string(bs))
+}
+
+func TestReadFieldFromFile(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/loadavg", []byte("0.52  0.58 0.59 1/389 12345\n"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/csv", []byte("a,,c"), 0o644))
+
+	field, err := utils.ReadFieldFromFile(fs, "/loadavg", 1, "")
+	require.NoError(t, err)
+	require.Equal(t, "0.58", field)
+
+	field, err = utils.ReadFieldFromFile(fs, "/csv", 1, ",")
+	require.NoError(t, err)
+	require.Equal(t, "", field)
+
+	_, err = utils.ReadFieldFromFile(fs, "/loadavg", 5, "")
+	require.Error(t, err)
+	_, err = utils.ReadFieldFromFile(fs, "/loadavg", -1, "")
+	require.Error(t, err)
+}
+
+func TestReadFileLinesMatching(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	long := strings.Repeat("x", 100*1024) + " ERROR"
+	content := "INFO start\nERROR disk full\nWARN slow\n" + long + "\n"
+	require.NoError(t, afero.WriteFile(fs, "/log", []byte(content), 0o644))
+
+	lines, err := utils.ReadFileLinesMatching(fs, "/log", regexp.MustCompile(`ERROR`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"ERROR disk full", long}, lines)
+
+	lines, err = utils.ReadFileLinesMatching(fs, "/log", regexp.MustCompile(`^DEBUG`))
+	require.NoError(t, err)
+	require.Empty(t, lines)
+
+	_, err = utils.ReadFileLinesMatching(fs, "/log", nil)
+	require.Error(t, err)
+}
+
+func TestSwapFiles(t *testing.T) {
+	swapped := func(t *testing.T, fs afero.Fs, a, b string) {
+		require.NoError(t, afero.WriteFile(fs, a, []byte("active"), 0o644))
+		require.NoError(t, afero.WriteFile(fs, b, []byte("prepared"), 0o600))
+		require.NoError(t, utils.SwapFiles(fs, a, b))
+
+		bs, err := afero.ReadFile(fs, a)
+		require.NoError(t, err)
+		require.Equal(t, "prepared", string(bs))
+		bs, err = afero.ReadFile(fs, b)
+		require.NoError(t, err)
+		require.Equal(t, "active", string(bs))
+
+		infos, err := afero.ReadDir(fs, filepath.Dir(a))
+		require.NoError(t, err)
+		require.Len(t, infos, 2, "no temporary file should be left behind")
+	}
+
+	t.Run("three-way rename", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		require.NoError(t, fs.MkdirAll("/etc", 0o755))
+		swapped(t, fs, "/etc/a.yaml", "/etc/b.yaml")
+	})
+
+	t.Run("os", func(t *testing.T) {
+		dir := t.TempDir()
+		swapped(t, afero.NewOsFs(), filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml"))
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, "/a", []byte("a"), 0o644))
+		err := utils.SwapFiles(fs, "/a", "/b")
+		require.ErrorIs(t, err, os.ErrNotExist)
+
+		bs, err := afero.ReadFile(fs, "/a")
+		require.NoError(t, err)
+		require.Equal(t, "a", string(bs))
+	})
+}
+
+func TestPreviewFile(t *testing.T) {
+	numbered := func(from, to int) []string {
+		var lines []string
+		for i := from; i <= to; i++ {
+			lines = append(lines, "line "+strconv.Itoa(i))
+		}
+		return lines
+	}
+	big := strings.Join(numbered(1, 5000), "\n") + "\n"
+
+	for _, test := range []struct {
+		name       string
+		content    string
+		head, tail int
+		expHead    []string
+		expTail    []string
+		expOmitted int
+	}{
+		{
+			name:       "large file",
+			content:    big,
+			head:       2,
+			tail:       3,
+			expHead:    numbered(1, 2),
+			expTail:    numbered(4998, 5000),
+			expOmitted: 4995,
+		},
+		{
+			name:    "head and tail overlap",
+			content: "a\nb\nc\n",
+			head:    2,
+			tail:    2,
+			expHead: []string{"a", "b"},
+			expTail: []string{"c"},
+		},
+		{
+			name:       "no trailing newline",
+			content:    "a\nb\nc\nd",
+			head:       1,
+			tail:       1,
+			expHead:    []string{"a"},
+			expTail:    []string{"d"},
+			expOmitted: 2,
+		},
+		{
+			name:       "only head",
+			content:    "a\r\nb\r\nc",
+			head:       1,
+			expHead:    []string{"a"},
+			expOmitted: 2,
+		},
+		{
+			name: "empty file",
+			head: 3,
+			tail: 3,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(fs, "/file", []byte(test.content), 0o644))
+			head, tail, omitted, err := utils.PreviewFile(fs, "/file", test.head, test.tail)
+			require.NoError(t, err)
+			require.Equal(t, test.expHead, head)
+			require.Equal(t, test.expTail, tail)
+			require.Equal(t, test.expOmitted, omitted)
+		})
+	}
+}
+
+func TestCheckFileSizeRange(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/empty.yaml", nil, 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/redpanda.yaml", []byte("redpanda: {}\n"), 0o644))
+
+	require.NoError(t, utils.CheckFileSizeRange(fs, "/redpanda.yaml", 1, 1024))
+	require.NoError(t, utils.CheckFileSizeRange(fs, "/redpanda.yaml", 13, 13))
+	require.NoError(t, utils.CheckFileSizeRange(fs, "/redpanda.yaml", 1, 0))
+	require.ErrorIs(t, utils.CheckFileSizeRange(fs, "/empty.yaml", 1, 0), utils.ErrFileTooSmall)
+	require.ErrorIs(t, utils.CheckFileSizeRange(fs, "/redpanda.yaml", 1, 12), utils.ErrFileTooLarge)
+	require.ErrorIs(t, utils.CheckFileSizeRange(fs, "/missing.yaml", 0, 0), os.ErrNotExist)
+}
+
+func TestReadUniqueLines(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	content := "b\na\n\nb\nc\n\na\n"
+	require.NoError(t, afero.WriteFile(fs, "/hosts", []byte(content), 0o644))
+
+	lines, err := utils.ReadUniqueLines(fs, "/hosts")
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "a", "", "c"}, lines)
+
+	bs, err := afero.ReadFile(fs, "/hosts")
+	require.NoError(t, err)
+	require.Equal(t, content, string(bs), "file should not be modified")
+}
+
+func TestResolveRelativeTo(t *testing.T) {
+	for _, test := range []struct {
+		base, ref, exp string
+	}{
+		{"/etc/redpanda/redpanda.yaml", "certs/ca.crt", "/etc/redpanda/certs/ca.crt"},
+		{"/etc/redpanda/redpanda.yaml", "../ca.crt", "/etc/ca.crt"},
+		{"/etc/redpanda/redpanda.yaml", "./a/../b.yaml", "/etc/redpanda/b.yaml"},
+		{"/etc/redpanda/redpanda.yaml", "/opt/ca.crt", "/opt/ca.crt"},
+		{"redpanda.yaml", "ca.crt", "ca.crt"},
+	} {
+		require.Equal(t, test.exp, utils.ResolveRelativeTo(test.base, test.ref), "%s from %s", test.ref, test.base)
+	}
+}
+
+func TestReadRelative(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/etc/redpanda/certs/ca.crt", []byte("ca"), 0o644))
+
+	bs, err := utils.ReadRelative(fs, "/etc/redpanda/redpanda.yaml", "certs/ca.crt")
+	require.NoError(t, err)
+	require.Equal(t, "ca", string(bs))
+
+	_, err = utils.ReadRelative(fs, "/etc/redpanda/redpanda.yaml", "ca.crt")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestReadConfigDir(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for name, content := range map[string]string{
+		"/conf.d/20-tls.yaml":        "tls: true",
+		"/conf.d/10-base.yaml":       "base: true\n",
+		"/conf.d/30-empty.yaml":      "",
+		"/conf.d/README.md":          "ignored",
+		"/conf.d/nested.yaml/a.yaml": "ignored",
+	} {
+		require.NoError(t, afero.WriteFile(fs, name, []byte(content), 0o644))
+	}
+
+	for _, ext := range []string{".yaml", "yaml"} {
+		bs, err := utils.ReadConfigDir(fs, "/conf.d", ext, false)
+		require.NoError(t, err)
+		require.Equal(t, "base: true\ntls: true\n", string(bs))
+	}
+
+	bs, err := utils.ReadConfigDir(fs, "/missing.d", ".yaml", true)
+	require.NoError(t, err)
+	require.Empty(t, bs)
+
+	_, err = utils.ReadConfigDir(fs, "/missing.d", ".yaml", false)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestReadSingleLineResolved(t *testing.T) {
+	t.Run("symlinks", func(t *testing.T) {
+		dir := t.TempDir()
+		fs := afero.NewOsFs()
+		require.NoError(t, fs.MkdirAll(filepath.Join(dir, "versions"), 0o755))
+		target := filepath.Join(dir, "versions", "v2")
+		require.NoError(t, afero.WriteFile(fs, target, []byte("v2.1.0\n"), 0o644))
+		require.NoError(t, os.Symlink("versions/v2", filepath.Join(dir, "current")))
+		require.NoError(t, os.Symlink(filepath.Join(dir, "current"), filepath.Join(dir, "latest")))
+		require.NoError(t, os.Symlink("loop", filepath.Join(dir, "loop")))
+
+		value, resolved, err := utils.ReadSingleLineResolved(fs, filepath.Join(dir, "latest"))
+		require.NoError(t, err)
+		require.Equal(t, "v2.1.0", value)
+		require.Equal(t, target, resolved)
+
+		_, _, err = utils.ReadSingleLineResolved(fs, filepath.Join(dir, "loop"))
+		require.Error(t, err)
+	})
+
+	t.Run("no symlink support", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, "/current", []byte("v1\n"), 0o644))
+		value, resolved, err := utils.ReadSingleLineResolved(fs, "/current")
+		require.NoError(t, err)
+		require.Equal(t, "v1", value)
+		require.Equal(t, "/current", resolved)
+	})
+}
+
+func TestWriteFileLinesDeterministic(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, utils.WriteFileLinesDeterministic(fs, []string{"a: 1  ", "b: 2\t", "", "c: 3", "", "  "}, "/one.yaml"))
+	require.NoError(t, utils.WriteFileLinesDeterministic(fs, []string{"a: 1", "b: 2", "", "c: 3\r"}, "/two.yaml"))
+
+	bs, err := afero.ReadFile(fs, "/one.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "a: 1\nb: 2\n\nc: 3\n", string(bs))
+
+	sumOne, err := utils.FileMd5(fs, "/one.yaml")
+	require.NoError(t, err)
+	sumTwo, err := utils.FileMd5(fs, "/two.yaml")
+	require.NoError(t, err)
+	require.Equal(t, sumOne, sumTwo)
+
+	require.NoError(t, utils.WriteFileLinesDeterministic(fs, []string{"", " "}, "/blank.yaml"))
+	bs, err = afero.ReadFile(fs, "/blank.yaml")
+	require.NoError(t, err)
+	require.Empty(t, bs)
+}
+
+func TestCountSubstring(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	content := "ERROR a ERROR b\nINFO c\nERRORERROR\n" + strings.Repeat("x", 100*1024) + "ERROR\naaaa"
+	require.NoError(t, afero.WriteFile(fs, "/log", []byte(content), 0o644))
+
+	n, err := utils.CountSubstring(fs, "/log", "ERROR")
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+
+	n, err = utils.CountSubstring(fs, "/log", "aa")
+	require.NoError(t, err)
+	require.Equal(t, 2, n, "occurrences should not overlap")
+
+	_, err = utils.CountSubstring(fs, "/log", "")
+	require.Error(t, err)
+}
+
+func TestAppendBounded(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, test := range []struct {
+		line     string
+		appended bool
+	}{
+		{"first", true},  // 6 bytes
+		{"second", true}, // 13 bytes
+		{"third!", false},
+		{"", true}, // 14 bytes, exactly at the cap
+		{"", false},
+	} {
+		appended, err := utils.AppendBounded(fs, test.line, "/audit.log", 14)
+		require.NoError(t, err)
+		require.Equal(t, test.appended, appended, "appending %q", test.line)
+	}
+	bs, err := afero.ReadFile(fs, "/audit.log")
+	require.NoError(t, err)
+	require.Equal(t, "first\nsecond\n\n", string(bs))
+
+	info, err := fs.Stat("/audit.log")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	appended, err := utils.AppendBounded(fs, "too long", "/missing.log", 4)
+	require.NoError(t, err)
+	require.False(t, appended)
+	exists, err := afero.Exists(fs, "/missing.log")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestReadPidFile(t *testing.T) {
+	dir := t.TempDir()
+	fs := afero.NewOsFs()
+	path := filepath.Join(dir, "redpanda.pid")
+	require.NoError(t, afero.WriteFile(fs, path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644))
+
+	pid, running, err := utils.ReadPidFile(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, os.Getpid(), pid)
+	require.True(t, running)
+
+	_, running, err = utils.ReadPidFile(afero.NewBasePathFs(fs, "/"), path)
+	require.NoError(t, err)
+	require.False(t, running, "liveness should only be checked on OsFs")
+
+	for _, content := range []string{"", "abc\n", "-1\n", "12\n34\n"} {
+		require.NoError(t, afero.WriteFile(fs, path, []byte(content), 0o644))
+		_, _, err := utils.ReadPidFile(fs, path)
+		require.Error(t, err, "content %q", content)
+	}
+}
+
+func TestReadFileExpand(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/fragment.yaml", []byte("host: ${HOST}\nport: $PORT\nprice: $$5\nunset: '${UNSET}'\n"), 0o644))
+	t.Setenv("HOST", "node-1")
+	t.Setenv("PORT", "9092")
+
+	bs, err := utils.ReadFileExpandEnv(fs, "/fragment.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "host: node-1\nport: 9092\nprice: $5\nunset: ''\n", string(bs))
+
+	vars := map[string]string{"HOST": "h", "PORT": "1"}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+	_, err = utils.ReadFileExpand(fs, "/fragment.yaml", lookup, true)
+	require.ErrorContains(t, err, "UNSET")
+
+	vars["UNSET"] = "set"
+	bs, err = utils.ReadFileExpand(fs, "/fragment.yaml", lookup, true)
+	require.NoError(t, err)
+	require.Equal(t, "host: h\nport: 1\nprice: $5\nunset: 'set'\n", string(bs))
+}
+
+func TestFindInDirs(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/opt/redpanda/bin/rpk-plugin", []byte("data"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/usr/bin/rpk-plugin", []byte("#!/bin/sh"), 0o755))
+	require.NoError(t, fs.MkdirAll("/usr/local/bin/rpk-plugin", 0o755))
+	dirs := []string{"/missing", "/usr/local/bin", "/opt/redpanda/bin", "/usr/bin"}
+
+	path, err := utils.FindInDirs(fs, "rpk-plugin", dirs, false)
+	require.NoError(t, err)
+	require.Equal(t, "/opt/redpanda/bin/rpk-plugin", path)
+
+	path, err = utils.FindInDirs(fs, "rpk-plugin", dirs, true)
+	require.NoError(t, err)
+	require.Equal(t, "/usr/bin/rpk-plugin", path)
+
+	_, err = utils.FindInDirs(fs, "other", dirs, false)
+	require.ErrorIs(t, err, utils.ErrNotFound)
+}
+
+func TestCreateIfAbsent(t *testing.T) {
+	for name, fs := range map[string]afero.Fs{
+		"memory": afero.NewMemMapFs(),
+		"os":     afero.NewBasePathFs(afero.NewOsFs(), t.TempDir()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, fs.MkdirAll("/etc/redpanda", 0o755))
+
+			created, err := utils.CreateIfAbsent(fs, "/etc/redpanda/redpanda.yaml", []byte("default"), 0o640)
+			require.NoError(t, err)
+			require.True(t, created)
+			info, err := fs.Stat("/etc/redpanda/redpanda.yaml")
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+			created, err = utils.CreateIfAbsent(fs, "/etc/redpanda/redpanda.yaml", []byte("other"), 0o600)
+			require.NoError(t, err)
+			require.False(t, created)
+			bs, err := afero.ReadFile(fs, "/etc/redpanda/redpanda.yaml")
+			require.NoError(t, err)
+			require.Equal(t, "default", string(bs))
+
+			_, err = utils.CreateIfAbsent(fs, "/missing/redpanda.yaml", nil, 0o600)
+			require.ErrorIs(t, err, os.ErrNotExist)
+		})
+	}
+}
+
+func TestReadFramedContent(t *testing.T) {
+	const (
+		begin = "-----BEGIN CERTIFICATE-----"
+		end   = "-----END CERTIFICATE-----"
+	)
+	for _, test := range []struct {
+		name    string
+		content string
+		exp     string
+		expErr  bool
+	}{
+		{
+			name:    "framed",
+			content: "subject=node\n" + begin + "\nMIIB\r\nAAAA\n" + end + "\ntrailing\n" + begin + "\nsecond\n" + end + "\n",
+			exp:     "MIIB\r\nAAAA\n",
+		},
+		{
+			name:    "empty frame",
+			content: begin + "\r\n" + end,
+			exp:     "",
+		},
+		{name: "missing begin", content: "MIIB\n", expErr: true},
+		{name: "missing end", content: begin + "\nMIIB\n", expErr: true},
+		{name: "out of order", content: end + "\nMIIB\n" + begin + "\n", expErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(fs, "/ca.pem", []byte(test.content), 0o644))
+			bs, err := utils.ReadFramedContent(fs, "/ca.pem", begin, end)
+			if test.expErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.exp, string(bs))
+		})
+	}
+}
+
+func TestReadExact(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/header", []byte{0xde, 0xad, 0xbe, 0xef, 0x01}, 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/empty", nil, 0o644))
+
+	bs, err := utils.ReadExact(fs, "/header", 4)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xde, 0xad, 0xbe, 0xef}, bs)
+
+	bs, err = utils.ReadExact(fs, "/header", 0)
+	require.NoError(t, err)
+	require.Empty(t, bs)
+
+	_, err = utils.ReadExact(fs, "/header", 6)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = utils.ReadExact(fs, "/empty", 1)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestNormalizeLineEndings(t *testing.T) {
+	for _, test := range []struct {
+		name, content, eol, exp string
+		changed                 bool
+	}{
+		{"mixed to lf", "a\r\nb\rc\nd", "\n", "a\nb\nc\nd", true},
+		{"mixed to crlf", "a\r\nb\rc\n\n", "\r\n", "a\r\nb\r\nc\r\n\r\n", true},
+		{"crlf to lf", "a\r\n\r\n", "\n", "a\n\n", true},
+		{"lone cr before crlf", "a\r\r\n", "\n", "a\n\n", true},
+		{"already lf", "a\nb\n", "\n", "a\nb\n", false},
+		{"already crlf", "a\r\nb\r\n", "\r\n", "a\r\nb\r\n", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(fs, "/file", []byte(test.content), 0o640))
+			changed, err := utils.NormalizeLineEndings(fs, "/file", test.eol)
+			require.NoError(t, err)
+			require.Equal(t, test.changed, changed)
+			bs, err := afero.ReadFile(fs, "/file")
+			require.NoError(t, err)
+			require.Equal(t, test.exp, string(bs))
+			info, err := fs.Stat("/file")
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+		})
+	}
+
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/file", nil, 0o644))
+	_, err := utils.NormalizeLineEndings(fs, "/file", "\r")
+	require.Error(t, err)
+}
+
+func TestReadFileLinesMax(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/seeds", []byte("a\nb\nc\n"), 0o644))
+
+	lines, err := utils.ReadFileLinesMax(fs, "/seeds", 3)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c"}, lines)
+
+	_, err = utils.ReadFileLinesMax(fs, "/seeds", 2)
+	require.Error(t, err)
+	_, err = utils.ReadFileLinesMax(fs, "/seeds", 0)
+	require.Error(t, err)
+
+	require.NoError(t, afero.WriteFile(fs, "/empty", nil, 0o644))
+	lines, err = utils.ReadFileLinesMax(fs, "/empty", 0)
+	require.NoError(t, err)
+	require.Empty(t, lines)
+	_, err = utils.ReadFileLinesMax(fs, "/empty", -1)
+	require.Error(t, err)
+}
+
+func TestCopyFileIntoSameDirectory(t *testing.T) {
+	dir := t.TempDir()
+	fs := afero.NewOsFs()
+	src := filepath.Join(dir, "a.conf")
+	require.NoError(t, afero.WriteFile(fs, src, []byte("a=1\n"), 0o644))
+	require.NoError(t, os.Symlink(dir, filepath.Join(dir, "link")))
+
+	for _, dstDir := range []string{dir, filepath.Join(dir, "link")} {
+		_, err := utils.CopyFileInto(fs, src, dstDir)
+		require.Error(t, err, dstDir)
+		bs, err := afero.ReadFile(fs, src)
+		require.NoError(t, err)
+		require.Equal(t, "a=1\n", string(bs))
+	}
+}
+
+func TestCopyFileInto(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/certs/ca.crt", []byte("ca"), 0o600))
+	require.NoError(t, afero.WriteFile(fs, "/file", nil, 0o644))
+
+	dst, err := utils.CopyFileInto(fs, "/certs/ca.crt", "/etc/redpanda/certs")
+	require.NoError(t, err)
+	require.Equal(t, "/etc/redpanda/certs/ca.crt", dst)
+	bs, err := afero.ReadFile(fs, dst)
+	require.NoError(t, err)
+	require.Equal(t, "ca", string(bs))
+
+	dst, err = utils.CopyFileInto(fs, "/certs/ca.crt", "/etc/redpanda/certs")
+	require.NoError(t, err, "copying into an existing directory should overwrite")
+	require.Equal(t, "/etc/redpanda/certs/ca.crt", dst)
+
+	_, err = utils.CopyFileInto(fs, "/certs/ca.crt", "/file")
+	require.Error(t, err)
+	_, err = utils.CopyFileInto(fs, "/certs/ca.crt", "/certs/")
+	require.Error(t, err)
+	bs, err = afero.ReadFile(fs, "/certs/ca.crt")
+	require.NoError(t, err)
+	require.Equal(t, "ca", string(bs), "copying into its own directory must not truncate src")
+	_, err = utils.CopyFileInto(fs, "/certs/missing.crt", "/etc")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestTrimToLastLines(t *testing.T) {
+	big := strings.Repeat("old line\n", 2000) + "kept 1\nkept 2\n"
+	for _, test := range []struct {
+		name, content string
+		n             int
+		exp           string
+		expRemoved    int
+	}{
+		{"large file", big, 2, "kept 1\nkept 2\n", 2000},
+		{"no trailing newline", "a\nb\nc", 2, "b\nc", 1},
+		{"under limit", "a\nb\n", 5, "a\nb\n", 0},
+		{"at limit", "a\nb\n", 2, "a\nb\n", 0},
+		{"zero", "a\nb", 0, "", 2},
+		{"negative", "a\nb\n", -1, "", 2},
+		{"empty", "", 0, "", 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(fs, "/log", []byte(test.content), 0o640))
+			removed, err := utils.TrimToLastLines(fs, "/log", test.n)
+			require.NoError(t, err)
+			require.Equal(t, test.expRemoved, removed)
+			bs, err := afero.ReadFile(fs, "/log")
+			require.NoError(t, err)
+			require.Equal(t, test.exp, string(bs))
+			info, err := fs.Stat("/log")
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+		})
+	}
+}
+
+func TestReadTokens(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	content := "# seed brokers\n  node-1:33145   node-2:33145\n\n\tnode-3:33145 # the new one\n#node-4:33145\n"
+	require.NoError(t, afero.WriteFile(fs, "/seeds", []byte(content), 0o644))
+
+	tokens, err := utils.ReadTokens(fs, "/seeds", "#")
+	require.NoError(t, err)
+	require.Equal(t, []string{"node-1:33145", "node-2:33145", "node-3:33145"}, tokens)
+
+	tokens, err = utils.ReadTokens(fs, "/seeds", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"#", "seed", "brokers", "node-1:33145", "node-2:33145", "node-3:33145",
+		"#", "the", "new", "one", "#node-4:33145",
+	}, tokens)
+}
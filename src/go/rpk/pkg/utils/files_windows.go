@@ -0,0 +1,45 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+//go:build windows
+
+package utils
+
+import (
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// preserveOwnership does nothing on Windows.
+func preserveOwnership(fs afero.Fs, stat os.FileInfo, file string) error {
+	return nil
+}
+
+// processExists reports whether a process with pid exists. On Windows,
+// FindProcess fails if it does not.
+func processExists(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	proc.Release()
+	return true
+}
+
+// syncDir does nothing on Windows, where directories cannot be fsynced and
+// renames are made durable by the filesystem.
+func syncDir(string) error {
+	return nil
+}
+
+// checkDirWritable does nothing on Windows, which has no access(2).
+func checkDirWritable(string) error {
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// jsonLocks holds a *sync.Mutex per cleaned path updated with UpdateJSON.
+var jsonLocks sync.Map
+
+// UpdateJSON performs a guarded read-modify-write of the JSON document in
+// path: the file is unmarshaled into a T, or the zero T if it does not exist,
+// transform is applied, and the result is marshaled with two space indentation
+// and atomically written back. Existing files keep their mode, and new files
+// are created with 0o600. If transform fails, the file is not written.
+//
+// Concurrent updates of the same path within this process are serialized;
+// nothing protects against concurrent writers in other processes.
+func UpdateJSON[T any](fs afero.Fs, path string, transform func(*T) error) error {
+	mu, _ := jsonLocks.LoadOrStore(filepath.Clean(path), new(sync.Mutex))
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	var (
+		v    T
+		perm os.FileMode = 0o600
+	)
+	info, err := fs.Stat(path)
+	switch {
+	case err == nil:
+		perm = info.Mode().Perm()
+		content, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %v", path, err)
+		}
+		if err := json.Unmarshal(content, &v); err != nil {
+			return fmt.Errorf("unable to decode %s: %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("unable to stat %s: %v", path, err)
+	}
+
+	if err := transform(&v); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(&v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode %s: %w", path, err)
+	}
+	return writeFileAtomic(fs, path, append(content, '\n'), perm)
+}
+
+// ReformatJSONFile re-indents the JSON document in path using indent, or two
+// spaces if indent is empty, and atomically rewrites the file, preserving its
+// mode. Key order is preserved. If the file is not valid JSON, it is left
+// untouched and the error reports the offset of the syntax error.
+func ReformatJSONFile(fs afero.Fs, path string, indent string) error {
+	if indent == "" {
+		indent = "  "
+	}
+	info, err := fs.Stat(path)
+	if err != nil {
+		return err
+	}
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimRight(content, " \t\r\n"), "", indent); err != nil {
+		var serr *json.SyntaxError
+		if errors.As(err, &serr) {
+			return fmt.Errorf("invalid JSON in %s at offset %d: %w", path, serr.Offset, err)
+		}
+		return fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+	buf.WriteByte('\n')
+	return writeFileAtomic(fs, path, buf.Bytes(), info.Mode().Perm())
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils_test
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReformatJSONFile(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := "/config.json"
+	require.NoError(t, afero.WriteFile(fs, path, []byte(`{"b":1,"a":[true,null]}`), 0o640))
+
+	require.NoError(t, utils.ReformatJSONFile(fs, path, ""))
+	bs, err := afero.ReadFile(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \"b\": 1,\n  \"a\": [\n    true,\n    null\n  ]\n}\n", string(bs))
+	info, err := fs.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	require.NoError(t, utils.ReformatJSONFile(fs, path, "\t"))
+	bs, err = afero.ReadFile(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, "{\n\t\"b\": 1,\n\t\"a\": [\n\t\ttrue,\n\t\tnull\n\t]\n}\n", string(bs))
+
+	invalid := []byte(`{"a": 1,}`)
+	require.NoError(t, afero.WriteFile(fs, path, invalid, 0o640))
+	err = utils.ReformatJSONFile(fs, path, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), path)
+	require.Contains(t, err.Error(), "offset 9")
+	bs, err = afero.ReadFile(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, invalid, bs)
+}
+
+func TestUpdateJSON(t *testing.T) {
+	type state struct {
+		Count int      `json:"count"`
+		Names []string `json:"names,omitempty"`
+	}
+	fs := afero.NewMemMapFs()
+	path := "/state.json"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := utils.UpdateJSON(fs, path, func(s *state) error {
+				s.Count++
+				return nil
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	bs, err := afero.ReadFile(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \"count\": 20\n}\n", string(bs))
+	info, err := fs.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	errStop := errors.New("stop")
+	err = utils.UpdateJSON(fs, path, func(s *state) error {
+		s.Names = append(s.Names, "ignored")
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	bs2, err := afero.ReadFile(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, bs, bs2)
+
+	require.NoError(t, afero.WriteFile(fs, "/bad.json", []byte("{"), 0o644))
+	err = utils.UpdateJSON(fs, "/bad.json", func(*state) error { return nil })
+	require.Error(t, err)
+}
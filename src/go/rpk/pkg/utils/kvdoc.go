@@ -0,0 +1,182 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// KVDoc is a key<sep>value style file that can be edited without disturbing
+// its comments, blank lines, ordering or formatting. Lines starting with '#'
+// (ignoring leading whitespace) are comments, as are lines without sep.
+type KVDoc struct {
+	sep   string
+	eol   string // The terminator for appended lines.
+	lines []kvLine
+}
+
+// kvLine is a single line of a KVDoc. raw excludes the line terminator, which
+// is kept in end. For value lines, raw[:valueAt] is everything up to and
+// including the separator and any whitespace after it.
+type kvLine struct {
+	raw     string
+	end     string
+	key     string
+	value   string
+	valueAt int
+	isValue bool
+}
+
+// ParseKeyValuePreserving reads the key<sep>value file at path into a KVDoc.
+// Each line's terminator, LF or CRLF, is kept, as is the lack of a newline
+// at the end of the file.
+func ParseKeyValuePreserving(fs afero.Fs, path, sep string) (*KVDoc, error) {
+	if sep == "" {
+		return nil, errors.New("unable to parse key-value file: empty separator")
+	}
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	doc := &KVDoc{sep: sep, eol: "\n"}
+	for i, line := range splitLinesKeepEnds(string(content)) {
+		raw, end := cutLineEnding(line)
+		if i == 0 && end != "" {
+			doc.eol = end
+		}
+		l := parseKVLine(raw, sep)
+		l.end = end
+		doc.lines = append(doc.lines, l)
+	}
+	return doc, nil
+}
+
+func parseKVLine(raw, sep string) kvLine {
+	trimmed := strings.TrimSpace(raw)
+	if strings.HasPrefix(trimmed, "#") {
+		return kvLine{raw: raw}
+	}
+	i := strings.Index(raw, sep)
+	if i < 0 {
+		return kvLine{raw: raw}
+	}
+	key := strings.TrimSpace(raw[:i])
+	if key == "" {
+		return kvLine{raw: raw}
+	}
+	rest := raw[i+len(sep):]
+	valueAt := len(raw) - len(strings.TrimLeft(rest, " \t"))
+	return kvLine{
+		raw:     raw,
+		key:     key,
+		value:   strings.TrimSpace(raw[valueAt:]),
+		valueAt: valueAt,
+		isValue: true,
+	}
+}
+
+// ReadKeyValueFile returns the keys and values of the key<sep>value file at
+// path, parsed as ParseKeyValuePreserving does. If a key appears more than
+// once, its first occurrence is used, as in KVDoc.Get.
+func ReadKeyValueFile(fs afero.Fs, path, sep string) (map[string]string, error) {
+	doc, err := ParseKeyValuePreserving(fs, path, sep)
+	if err != nil {
+		return nil, err
+	}
+	kvs := make(map[string]string)
+	for _, l := range doc.lines {
+		if _, ok := kvs[l.key]; l.isValue && !ok {
+			kvs[l.key] = l.value
+		}
+	}
+	return kvs, nil
+}
+
+// MergeKeyValueFiles reads each of paths with ReadKeyValueFile and merges
+// them in order, with later files overriding earlier ones on the same key. If
+// skipMissing is true, paths that do not exist are skipped; otherwise they are
+// an error.
+func MergeKeyValueFiles(fs afero.Fs, paths []string, sep string, skipMissing bool) (map[string]string, error) {
+	merged := make(map[string]string)
+	for _, path := range paths {
+		kvs, err := ReadKeyValueFile(fs, path, sep)
+		if skipMissing && os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range kvs {
+			merged[k] = v
+		}
+	}
+	return merged, nil
+}
+
+// Get returns the value of key, and whether it is set. If key appears more
+// than once, its first occurrence is used, as in SetKeyLine.
+func (d *KVDoc) Get(key string) (string, bool) {
+	if i := d.index(key); i >= 0 {
+		return d.lines[i].value, true
+	}
+	return "", false
+}
+
+// Set sets key to value. An existing key is updated in place, keeping the
+// formatting of its line up to the value; a new key is appended at the end,
+// with the document's line terminator.
+func (d *KVDoc) Set(key, value string) {
+	if i := d.index(key); i >= 0 {
+		l := &d.lines[i]
+		l.raw = l.raw[:l.valueAt] + value
+		l.value = value
+		return
+	}
+	end := d.eol
+	if n := len(d.lines); n > 0 && d.lines[n-1].end == "" {
+		// Keep the lack of a final newline.
+		d.lines[n-1].end, end = d.eol, ""
+	}
+	d.lines = append(d.lines, kvLine{
+		raw:     key + d.sep + value,
+		end:     end,
+		key:     key,
+		value:   value,
+		valueAt: len(key) + len(d.sep),
+		isValue: true,
+	})
+}
+
+func (d *KVDoc) index(key string) int {
+	for i, l := range d.lines {
+		if l.isValue && l.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// WriteTo writes the document to w, each line with its original terminator.
+func (d *KVDoc) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for _, l := range d.lines {
+		n, err := io.WriteString(w, l.raw+l.end)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVDoc(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	content := `# Tuned by rpk
+vm.swappiness = 1
+
+  net.core.somaxconn=1024
+not a value line
+vm.swappiness = 60
+`
+	require.NoError(t, afero.WriteFile(fs, "/sysctl.conf", []byte(content), 0o644))
+
+	doc, err := utils.ParseKeyValuePreserving(fs, "/sysctl.conf", "=")
+	require.NoError(t, err)
+
+	var unchanged strings.Builder
+	_, err = doc.WriteTo(&unchanged)
+	require.NoError(t, err)
+	require.Equal(t, content, unchanged.String())
+
+	v, ok := doc.Get("vm.swappiness")
+	require.True(t, ok)
+	require.Equal(t, "1", v)
+	v, ok = doc.Get("net.core.somaxconn")
+	require.True(t, ok)
+	require.Equal(t, "1024", v)
+	_, ok = doc.Get("not a value line")
+	require.False(t, ok)
+
+	doc.Set("net.core.somaxconn", "4096")
+	doc.Set("fs.aio-max-nr", "1048576")
+	v, _ = doc.Get("fs.aio-max-nr")
+	require.Equal(t, "1048576", v)
+
+	var edited strings.Builder
+	n, err := doc.WriteTo(&edited)
+	require.NoError(t, err)
+	require.Equal(t, int64(edited.Len()), n)
+	require.Equal(t, `# Tuned by rpk
+vm.swappiness = 1
+
+  net.core.somaxconn=4096
+not a value line
+vm.swappiness = 60
+fs.aio-max-nr=1048576
+`, edited.String())
+
+	_, err = utils.ParseKeyValuePreserving(fs, "/sysctl.conf", "")
+	require.Error(t, err)
+}
+
+func TestKVDocCRLF(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, test := range []struct {
+		content, exp string
+	}{
+		{"# c\r\na = 1\r\nb=2\r\n", "# c\r\na = 9\r\nb=2\r\nz=0\r\n"},
+		{"# c\r\na = 1\r\nb=2", "# c\r\na = 9\r\nb=2\r\nz=0"},
+		{"a=1", "a=9\nz=0"},
+	} {
+		require.NoError(t, afero.WriteFile(fs, "/file.conf", []byte(test.content), 0o644))
+		doc, err := utils.ParseKeyValuePreserving(fs, "/file.conf", "=")
+		require.NoError(t, err)
+
+		var unchanged strings.Builder
+		_, err = doc.WriteTo(&unchanged)
+		require.NoError(t, err)
+		require.Equal(t, test.content, unchanged.String())
+
+		v, ok := doc.Get("a")
+		require.True(t, ok)
+		require.Equal(t, "1", v, "the terminator should not be part of the value")
+		doc.Set("a", "9")
+		doc.Set("z", "0")
+		var edited strings.Builder
+		_, err = doc.WriteTo(&edited)
+		require.NoError(t, err)
+		require.Equal(t, test.exp, edited.String())
+	}
+}
+
+func TestMergeKeyValueFiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/defaults.conf", []byte("# defaults\na=1\nb=2\nb=ignored\n"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/site.conf", []byte("b = 20\nc=30\n"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/local.conf", []byte("c=300\n"), 0o644))
+
+	kvs, err := utils.ReadKeyValueFile(fs, "/defaults.conf", "=")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"a": "1", "b": "2"}, kvs)
+
+	paths := []string{"/defaults.conf", "/missing.conf", "/site.conf", "/local.conf"}
+	merged, err := utils.MergeKeyValueFiles(fs, paths, "=", true)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"a": "1", "b": "20", "c": "300"}, merged)
+
+	_, err = utils.MergeKeyValueFiles(fs, paths, "=", false)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// LineIndex records the byte offset at which each line of a file starts,
+// allowing random access to lines without rescanning the file. The index is
+// exported so that it can be serialized and cached, but it is only valid for
+// as long as the file it was built from is unchanged.
+type LineIndex struct {
+	Offsets []int64 `json:"offsets"`
+}
+
+// BuildLineIndex scans path once and returns the index of its lines.
+func BuildLineIndex(fs afero.Fs, path string) (*LineIndex, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		idx    LineIndex
+		offset int64
+		atEOL  = true
+		r      = bufio.NewReader(file)
+	)
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(chunk) > 0 && atEOL {
+			idx.Offsets = append(idx.Offsets, offset)
+		}
+		offset += int64(len(chunk))
+		atEOL = len(chunk) > 0 && chunk[len(chunk)-1] == '\n'
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return &idx, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %v", path, err)
+		}
+	}
+}
+
+// Len returns the number of lines in the index.
+func (idx *LineIndex) Len() int {
+	return len(idx.Offsets)
+}
+
+// Line returns line n of path, counting from 1, without its line terminator,
+// by seeking directly to where the line starts.
+func (idx *LineIndex) Line(fs afero.Fs, path string, n int) (string, error) {
+	if n < 1 || n > len(idx.Offsets) {
+		return "", fmt.Errorf("line %d out of range: %s has lines 1 to %d", n, path, len(idx.Offsets))
+	}
+	file, err := fs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(idx.Offsets[n-1], io.SeekStart); err != nil {
+		return "", fmt.Errorf("unable to seek to line %d of %s: %v", n, path, err)
+	}
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("unable to read line %d of %s: %v", n, path, err)
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineIndex(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	long := strings.Repeat("x", 10000)
+	content := "first\n\nthird\r\n" + long + "\nlast without newline"
+	require.NoError(t, afero.WriteFile(fs, "/f", []byte(content), 0o644))
+
+	idx, err := utils.BuildLineIndex(fs, "/f")
+	require.NoError(t, err)
+	require.Equal(t, 5, idx.Len())
+
+	bs, err := json.Marshal(idx)
+	require.NoError(t, err)
+	var cached utils.LineIndex
+	require.NoError(t, json.Unmarshal(bs, &cached))
+
+	exp := []string{"first", "", "third", long, "last without newline"}
+	for i := len(exp) - 1; i >= 0; i-- {
+		line, err := cached.Line(fs, "/f", i+1)
+		require.NoError(t, err)
+		require.Equal(t, exp[i], line)
+	}
+	for _, n := range []int{0, 6} {
+		_, err = cached.Line(fs, "/f", n)
+		require.Error(t, err, n)
+	}
+
+	require.NoError(t, afero.WriteFile(fs, "/empty", nil, 0o644))
+	idx, err = utils.BuildLineIndex(fs, "/empty")
+	require.NoError(t, err)
+	require.Zero(t, idx.Len())
+}
@@ -0,0 +1,288 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// manifestEntry is a single line of a checksum manifest.
+type manifestEntry struct {
+	sum  string
+	path string // Relative to the manifest root, slash separated.
+}
+
+// WriteChecksumManifest walks root and atomically writes to manifestPath the
+// SHA-256 of every regular file under it, one "<hex>  <relpath>" line per file
+// sorted by path. This is the format of coreutils' sha256sum, including its
+// escaping of names with a backslash or newline, so the manifest can be
+// checked with `sha256sum -c` from within root. If manifestPath is under root,
+// it is not included in the manifest.
+func WriteChecksumManifest(fs afero.Fs, root, manifestPath string) error {
+	manifestAbs, err := filepath.Abs(manifestPath)
+	if err != nil {
+		return fmt.Errorf("unable to resolve %s: %v", manifestPath, err)
+	}
+	var entries []manifestEntry
+	err = afero.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if abs, err := filepath.Abs(path); err == nil && abs == manifestAbs {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		sum, err := fileDigest(fs, path, sha256.New())
+		if err != nil {
+			return err
+		}
+		entries = append(entries, manifestEntry{sum, filepath.ToSlash(rel)})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to checksum %s: %v", root, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].path < entries[j].path })
+
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(checksumLine(e.sum, e.path))
+	}
+	return writeFileAtomic(fs, manifestPath, []byte(b.String()), 0o644)
+}
+
+// VerifyChecksumManifest checks the files under root against the manifest at
+// manifestPath, and returns the relative paths of the files that are missing
+// or whose SHA-256 does not match. Files under root that are not listed in
+// the manifest are ignored.
+func VerifyChecksumManifest(fs afero.Fs, root, manifestPath string) ([]string, error) {
+	entries, err := readChecksumManifest(fs, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var bad []string
+	for _, e := range entries {
+		sum, err := fileDigest(fs, filepath.Join(root, filepath.FromSlash(e.path)), sha256.New())
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err != nil || sum != e.sum {
+			bad = append(bad, e.path)
+		}
+	}
+	return bad, nil
+}
+
+// ReconcileTree checks the files under targetRoot against the manifest at
+// manifestPath, like VerifyChecksumManifest, and returns the relative paths of
+// the missing or mismatched files in fixed. If repair is true, each of them is
+// atomically replaced by its counterpart under sourceRoot, which must match
+// the manifest; otherwise fixed lists what would be replaced. Regular files
+// under targetRoot that the manifest does not list are returned in unlisted,
+// but never removed.
+func ReconcileTree(fs afero.Fs, manifestPath, targetRoot, sourceRoot string, repair bool) (fixed, unlisted []string, err error) {
+	entries, err := readChecksumManifest(fs, manifestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	bad, err := VerifyChecksumManifest(fs, targetRoot, manifestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	sums := make(map[string]string, len(entries))
+	for _, e := range entries {
+		sums[e.path] = e.sum
+	}
+	for _, rel := range bad {
+		if repair {
+			src := filepath.Join(sourceRoot, filepath.FromSlash(rel))
+			dst := filepath.Join(targetRoot, filepath.FromSlash(rel))
+			if err := restoreVerified(fs, src, dst, sums[rel]); err != nil {
+				return fixed, nil, err
+			}
+		}
+		fixed = append(fixed, rel)
+	}
+
+	manifestAbs, err := filepath.Abs(manifestPath)
+	if err != nil {
+		return fixed, nil, fmt.Errorf("unable to resolve %s: %v", manifestPath, err)
+	}
+	err = afero.Walk(fs, targetRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if abs, err := filepath.Abs(path); err == nil && abs == manifestAbs {
+			return nil
+		}
+		rel, err := filepath.Rel(targetRoot, path)
+		if err != nil {
+			return err
+		}
+		if _, ok := sums[filepath.ToSlash(rel)]; !ok {
+			unlisted = append(unlisted, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return fixed, nil, fmt.Errorf("unable to walk %s: %v", targetRoot, err)
+	}
+	sort.Strings(unlisted)
+	return fixed, unlisted, nil
+}
+
+// restoreVerified atomically copies src over dst, keeping the mode of src, if
+// the SHA-256 of src is sum. Otherwise dst is left untouched.
+func restoreVerified(fs afero.Fs, src, dst, sum string) error {
+	in, err := fs.Open(src)
+	if err != nil {
+		return fmt.Errorf("unable to open repair source: %w", err)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to stat %s: %v", src, err)
+	}
+	if err := fs.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("unable to create directory for %s: %v", dst, err)
+	}
+	out, err := createAtomicFile(fs, dst, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, h), in); err != nil {
+		out.Abort()
+		return fmt.Errorf("unable to copy %s to %s: %v", src, dst, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		out.Abort()
+		return fmt.Errorf("unable to repair %s: source %s has SHA-256 %s, expected %s", dst, src, got, sum)
+	}
+	return out.Commit()
+}
+
+// WriteWithChecksumSidecar atomically writes bs to path, then writes the
+// sidecar path.sha256 with a "<hex>  <basename>" line that `sha256sum -c` can
+// check from path's directory, and returns the hex digest. Both files are
+// written with 0o644. If writing the sidecar fails, no partial sidecar is
+// left behind, but path is kept.
+func WriteWithChecksumSidecar(fs afero.Fs, bs []byte, path string) (string, error) {
+	if err := writeFileAtomic(fs, path, bs, 0o644); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bs)
+	digest := hex.EncodeToString(sum[:])
+	sidecar := checksumLine(digest, filepath.Base(path))
+	if err := writeFileAtomic(fs, path+".sha256", []byte(sidecar), 0o644); err != nil {
+		return "", fmt.Errorf("unable to write checksum of %s: %v", path, err)
+	}
+	return digest, nil
+}
+
+// checksumEscaper escapes names for checksumLine as coreutils does.
+var checksumEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// checksumLine returns the sha256sum line for name with the given hex digest.
+// As in coreutils, a name containing a backslash or newline has them escaped
+// as `\\` and `\n`, and the line is prefixed with a backslash to mark it.
+func checksumLine(sum, name string) string {
+	if strings.ContainsAny(name, "\\\n") {
+		return `\` + sum + "  " + checksumEscaper.Replace(name) + "\n"
+	}
+	return sum + "  " + name + "\n"
+}
+
+// unescapeChecksumName reverses the escaping of checksumLine, reporting false
+// if name holds an escape other than `\\` or `\n`.
+func unescapeChecksumName(name string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '\\' {
+			b.WriteByte(name[i])
+			continue
+		}
+		if i++; i == len(name) {
+			return "", false
+		}
+		switch name[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// readChecksumManifest parses a sha256sum style manifest, accepting both the
+// text ("<hex>  <path>") and binary ("<hex> *<path>") line forms, and lines
+// with escaped names, as written by checksumLine.
+func readChecksumManifest(fs afero.Fs, manifestPath string) ([]manifestEntry, error) {
+	lines, err := ReadFileLines(fs, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var entries []manifestEntry
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		escaped := strings.HasPrefix(line, `\`)
+		sum, path, ok := strings.Cut(strings.TrimPrefix(line, `\`), " ")
+		if ok && (strings.HasPrefix(path, " ") || strings.HasPrefix(path, "*")) {
+			path = path[1:]
+		} else {
+			ok = false
+		}
+		if ok && escaped {
+			path, ok = unescapeChecksumName(path)
+		}
+		if !ok || len(sum) != sha256.Size*2 || path == "" {
+			return nil, fmt.Errorf("%s: malformed manifest line %d: %q", manifestPath, i+1, line)
+		}
+		if !isLocalPath(filepath.FromSlash(path)) {
+			return nil, fmt.Errorf("%s: manifest line %d: path %q is not local to the manifest root", manifestPath, i+1, path)
+		}
+		entries = append(entries, manifestEntry{strings.ToLower(sum), path})
+	}
+	return entries, nil
+}
+
+// isLocalPath reports whether path is relative and, once cleaned, stays within
+// the directory it is relative to. It is filepath.IsLocal, which is not
+// available until Go 1.20, without the checks for reserved Windows names.
+func isLocalPath(path string) bool {
+	if path == "" || filepath.IsAbs(path) || filepath.VolumeName(path) != "" || os.IsPathSeparator(path[0]) {
+		return false
+	}
+	clean := filepath.Clean(path)
+	return clean != ".." && !strings.HasPrefix(clean, ".."+string(filepath.Separator))
+}
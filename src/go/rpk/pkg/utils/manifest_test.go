@@ -0,0 +1,187 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksumManifest(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for path, content := range map[string]string{
+		"/release/bin/rpk":       "rpk binary",
+		"/release/lib/libfoo.so": "lib",
+		"/release/conf/redpanda": "conf",
+	} {
+		require.NoError(t, afero.WriteFile(fs, path, []byte(content), 0o644))
+	}
+
+	manifest := "/release/SHA256SUMS"
+	require.NoError(t, utils.WriteChecksumManifest(fs, "/release", manifest))
+	bs, err := afero.ReadFile(fs, manifest)
+	require.NoError(t, err)
+	require.Equal(t,
+		"cf20258c0335909368808fa04e6821c9abc5c7357ad947c50aef432c5e106cf2  bin/rpk\n"+
+			"0c326c4f02797b088fc566e64fbfe2162390f52f2fec1483ec3a413a7f11c910  conf/redpanda\n"+
+			"76b5a357391276b282a516f54f48ef3c207f46d8192dc58c208d5183d38415f8  lib/libfoo.so\n",
+		string(bs))
+
+	bad, err := utils.VerifyChecksumManifest(fs, "/release", manifest)
+	require.NoError(t, err)
+	require.Empty(t, bad)
+
+	require.NoError(t, afero.WriteFile(fs, "/release/bin/rpk", []byte("tampered"), 0o755))
+	require.NoError(t, fs.Remove("/release/lib/libfoo.so"))
+	require.NoError(t, afero.WriteFile(fs, "/release/extra", []byte("x"), 0o644))
+	bad, err = utils.VerifyChecksumManifest(fs, "/release", manifest)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bin/rpk", "lib/libfoo.so"}, bad)
+}
+
+func TestChecksumManifestEscapedNames(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/release/n\nl", []byte("newline"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, `/release/back\slash`, []byte("backslash"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/release/plain", []byte("plain"), 0o644))
+
+	manifest := "/SHA256SUMS"
+	require.NoError(t, utils.WriteChecksumManifest(fs, "/release", manifest))
+	bs, err := afero.ReadFile(fs, manifest)
+	require.NoError(t, err)
+	require.Equal(t,
+		`\dcc8bea64340a9d9a29f443dae6a680eb612e746106ecf2760235a7e3328477b  back\\slash`+"\n"+
+			`\ea889d83ced8341fef3701cea937b4cddf401e3825d8ede49fee1a4c7fe21663  n\nl`+"\n"+
+			"a116c9ed46d6207734a43317d30fd88f52ac8634c37d904bbf4e41d865f90475  plain\n",
+		string(bs))
+
+	bad, err := utils.VerifyChecksumManifest(fs, "/release", manifest)
+	require.NoError(t, err)
+	require.Empty(t, bad)
+
+	require.NoError(t, afero.WriteFile(fs, "/release/n\nl", []byte("tampered"), 0o644))
+	bad, err = utils.VerifyChecksumManifest(fs, "/release", manifest)
+	require.NoError(t, err)
+	require.Equal(t, []string{"n\nl"}, bad)
+}
+
+func TestVerifyChecksumManifestMalformed(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, line := range []string{
+		"abc file",
+		`\a116c9ed46d6207734a43317d30fd88f52ac8634c37d904bbf4e41d865f90475  bad\tescape`,
+	} {
+		require.NoError(t, afero.WriteFile(fs, "/SHA256SUMS", []byte(line+"\n"), 0o644))
+		_, err := utils.VerifyChecksumManifest(fs, "/", "/SHA256SUMS")
+		require.Error(t, err, line)
+	}
+}
+
+func TestReconcileTree(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, root := range []string{"/source", "/target"} {
+		for path, content := range map[string]string{
+			"bin/rpk":       "rpk binary",
+			"lib/libfoo.so": "lib",
+			"conf/redpanda": "conf",
+		} {
+			require.NoError(t, afero.WriteFile(fs, root+"/"+path, []byte(content), 0o644))
+		}
+	}
+	require.NoError(t, utils.WriteChecksumManifest(fs, "/source", "/SHA256SUMS"))
+
+	require.NoError(t, afero.WriteFile(fs, "/target/bin/rpk", []byte("tampered"), 0o644))
+	require.NoError(t, fs.RemoveAll("/target/lib"))
+	require.NoError(t, afero.WriteFile(fs, "/target/extra", []byte("x"), 0o644))
+
+	fixed, unlisted, err := utils.ReconcileTree(fs, "/SHA256SUMS", "/target", "/source", false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bin/rpk", "lib/libfoo.so"}, fixed)
+	require.Equal(t, []string{"extra"}, unlisted)
+	bs, err := afero.ReadFile(fs, "/target/bin/rpk")
+	require.NoError(t, err)
+	require.Equal(t, "tampered", string(bs), "dry run should not repair")
+
+	fixed, unlisted, err = utils.ReconcileTree(fs, "/SHA256SUMS", "/target", "/source", true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bin/rpk", "lib/libfoo.so"}, fixed)
+	require.Equal(t, []string{"extra"}, unlisted)
+	bad, err := utils.VerifyChecksumManifest(fs, "/target", "/SHA256SUMS")
+	require.NoError(t, err)
+	require.Empty(t, bad)
+	exists, err := afero.Exists(fs, "/target/extra")
+	require.NoError(t, err)
+	require.True(t, exists, "unlisted files should not be removed")
+
+	// A corrupt source is never copied over the target.
+	require.NoError(t, afero.WriteFile(fs, "/target/conf/redpanda", []byte("tampered"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/source/conf/redpanda", []byte("corrupt"), 0o644))
+	_, _, err = utils.ReconcileTree(fs, "/SHA256SUMS", "/target", "/source", true)
+	require.Error(t, err)
+	bs, err = afero.ReadFile(fs, "/target/conf/redpanda")
+	require.NoError(t, err)
+	require.Equal(t, "tampered", string(bs))
+}
+
+func TestWriteWithChecksumSidecar(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, fs.MkdirAll("/dist", 0o755))
+
+	digest, err := utils.WriteWithChecksumSidecar(fs, []byte("rpk binary"), "/dist/rpk")
+	require.NoError(t, err)
+	require.Equal(t, "cf20258c0335909368808fa04e6821c9abc5c7357ad947c50aef432c5e106cf2", digest)
+
+	bs, err := afero.ReadFile(fs, "/dist/rpk.sha256")
+	require.NoError(t, err)
+	require.Equal(t, digest+"  rpk\n", string(bs))
+
+	// The sidecar can be checked like any manifest.
+	bad, err := utils.VerifyChecksumManifest(fs, "/dist", "/dist/rpk.sha256")
+	require.NoError(t, err)
+	require.Empty(t, bad)
+
+	// A failed sidecar write keeps the main file and leaves no sidecar:
+	// renaming the sidecar into place fails over a directory.
+	fs = afero.NewBasePathFs(afero.NewOsFs(), t.TempDir())
+	require.NoError(t, fs.MkdirAll("/dist/tool.sha256", 0o755))
+	_, err = utils.WriteWithChecksumSidecar(fs, []byte("tool"), "/dist/tool")
+	require.Error(t, err)
+	bs, err = afero.ReadFile(fs, "/dist/tool")
+	require.NoError(t, err)
+	require.Equal(t, "tool", string(bs))
+	infos, err := afero.ReadDir(fs, "/dist")
+	require.NoError(t, err)
+	require.Len(t, infos, 2, "no temporary sidecar should be left behind")
+}
+
+func TestChecksumManifestTraversal(t *testing.T) {
+	const sum = "cf20258c0335909368808fa04e6821c9abc5c7357ad947c50aef432c5e106cf2"
+	for _, path := range []string{"../evil", "bin/../../evil", "/etc/passwd", ".."} {
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, "/data/source/evil", []byte("rpk binary"), 0o644))
+		require.NoError(t, afero.WriteFile(fs, "/data/source/bin/rpk", []byte("rpk binary"), 0o644))
+		require.NoError(t, fs.MkdirAll("/data/target", 0o755))
+		require.NoError(t, afero.WriteFile(fs, "/SHA256SUMS", []byte(sum+"  bin/rpk\n"+sum+"  "+path+"\n"), 0o644))
+
+		_, err := utils.VerifyChecksumManifest(fs, "/data/target", "/SHA256SUMS")
+		require.Error(t, err, path)
+		_, _, err = utils.ReconcileTree(fs, "/SHA256SUMS", "/data/target", "/data/source", true)
+		require.Error(t, err, path)
+		exists, err := afero.Exists(fs, "/data/evil")
+		require.NoError(t, err)
+		require.False(t, exists, path)
+		exists, err = afero.Exists(fs, "/data/target/bin/rpk")
+		require.NoError(t, err)
+		require.False(t, exists, "nothing should be repaired from a malicious manifest")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/spf13/afero"
+)
+
+// OpenMaybeGzip opens path for streaming, transparently decompressing it if it
+// starts with the gzip magic bytes. Closing the returned reader closes both
+// the decompressor, if any, and the underlying file.
+func OpenMaybeGzip(fs afero.Fs, path string) (io.ReadCloser, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(file)
+	magic, err := br.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		file.Close()
+		return nil, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return &layeredReadCloser{Reader: br, closers: []io.Closer{file}}, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("unable to decompress %s: %v", path, err)
+	}
+	return &layeredReadCloser{Reader: gz, closers: []io.Closer{gz, file}}, nil
+}
+
+// OpenWithHash opens path for streaming and feeds everything read from it to
+// h, which is reset first. The returned function returns the hex digest of the
+// bytes read so far, which is the digest of the whole file once the reader
+// has reached EOF.
+func OpenWithHash(fs afero.Fs, path string, h hash.Hash) (io.ReadCloser, func() string, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	h.Reset()
+	digest := func() string { return hex.EncodeToString(h.Sum(nil)) }
+	return &layeredReadCloser{Reader: io.TeeReader(file, h), closers: []io.Closer{file}}, digest, nil
+}
+
+// layeredReadCloser reads from Reader and, on Close, closes each of closers in
+// order, returning the first error.
+type layeredReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (l *layeredReadCloser) Close() error {
+	var first error
+	for _, c := range l.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenMaybeGzip(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	content := "some log line\nanother line\n"
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, afero.WriteFile(fs, "/log.gz", buf.Bytes(), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/log", []byte(content), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/short", []byte("x"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/empty", nil, 0o644))
+
+	for path, exp := range map[string]string{
+		"/log.gz": content,
+		"/log":    content,
+		"/short":  "x",
+		"/empty":  "",
+	} {
+		rc, err := utils.OpenMaybeGzip(fs, path)
+		require.NoError(t, err, path)
+		bs, err := io.ReadAll(rc)
+		require.NoError(t, err, path)
+		require.Equal(t, exp, string(bs), path)
+		require.NoError(t, rc.Close(), path)
+	}
+}
+
+func TestOpenWithHash(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/bundle.zip", []byte("hello world\n"), 0o644))
+
+	h := sha256.New()
+	h.Write([]byte("stale state"))
+	rc, digest, err := utils.OpenWithHash(fs, "/bundle.zip", h)
+	require.NoError(t, err)
+	bs, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, "hello world\n", string(bs))
+	require.Equal(t, "a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447", digest())
+
+	_, _, err = utils.OpenWithHash(fs, "/missing", sha256.New())
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// ScanLinesInto parses a fixed-layout file into the struct dst points to.
+// Every field tagged `line:"N"` is set to the trimmed content of the file's
+// 1-based Nth line, converted to the field's type, which must be a string, a
+// bool, or a signed or unsigned integer. Untagged fields and lines that no
+// field maps are ignored. It is an error for the file to be shorter than the
+// largest tagged line number.
+func ScanLinesInto(fs afero.Fs, path string, dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("unable to scan %s: destination must be a non-nil struct pointer, got %T", path, dst)
+	}
+	lines, err := ReadFileLines(fs, path)
+	if err != nil {
+		return err
+	}
+
+	v = v.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("line")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(tag)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid line tag %q on field %s: must be a positive line number", tag, field.Name)
+		}
+		if !field.IsExported() {
+			return fmt.Errorf("unable to set unexported field %s", field.Name)
+		}
+		if n > len(lines) {
+			return fmt.Errorf("unable to scan field %s: %s has %d lines, expected at least %d", field.Name, path, len(lines), n)
+		}
+		if err := setFromString(v.Field(i), strings.TrimSpace(lines[n-1])); err != nil {
+			return fmt.Errorf("unable to scan field %s from line %d of %s: %v", field.Name, n, path, err)
+		}
+	}
+	return nil
+}
+
+func setFromString(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
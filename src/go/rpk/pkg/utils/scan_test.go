@@ -0,0 +1,58 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanLinesInto(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/status", []byte("  node-1 \n42\ntrue\n-7\nignored\n"), 0o644))
+
+	var status struct {
+		Name    string `line:"1"`
+		Cores   uint16 `line:"2"`
+		Online  bool   `line:"3"`
+		Offset  int64  `line:"4"`
+		Comment string
+	}
+	require.NoError(t, utils.ScanLinesInto(fs, "/status", &status))
+	require.Equal(t, "node-1", status.Name)
+	require.Equal(t, uint16(42), status.Cores)
+	require.True(t, status.Online)
+	require.Equal(t, int64(-7), status.Offset)
+	require.Empty(t, status.Comment)
+
+	for name, dst := range map[string]any{
+		"short file": &struct {
+			X string `line:"6"`
+		}{},
+		"bad int": &struct {
+			X int `line:"1"`
+		}{},
+		"negative unsigned": &struct {
+			X uint8 `line:"4"`
+		}{},
+		"unsupported type": &struct {
+			X float64 `line:"2"`
+		}{},
+		"bad tag": &struct {
+			X string `line:"0"`
+		}{},
+		"not a pointer": status,
+	} {
+		require.Error(t, utils.ScanLinesInto(fs, "/status", dst), name)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/spf13/afero"
+)
+
+// Snapshot holds the contents and permissions of a set of files in memory, so
+// that a multi-step operation editing them can roll them back on failure.
+// Paths are stored as given, so a snapshot should only be used with a single
+// filesystem. The zero value is ready to use; it is not safe for concurrent
+// use.
+type Snapshot struct {
+	files map[string]snapshotFile
+}
+
+type snapshotFile struct {
+	exists  bool
+	mode    os.FileMode
+	content []byte
+}
+
+// Capture records the current state of each of paths, including whether it
+// exists. A path that was already captured keeps its earlier state, so that
+// Restore always returns to the state before the first Capture. If any path
+// cannot be captured, for example because it is a directory, nothing from
+// this call is recorded.
+func (s *Snapshot) Capture(fs afero.Fs, paths ...string) error {
+	captured := make(map[string]snapshotFile, len(paths))
+	for _, path := range paths {
+		if _, ok := s.files[path]; ok {
+			continue
+		}
+		info, err := fs.Stat(path)
+		if os.IsNotExist(err) {
+			captured[path] = snapshotFile{}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to stat %s: %v", path, err)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("unable to capture %s: not a regular file", path)
+		}
+		content, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %v", path, err)
+		}
+		captured[path] = snapshotFile{exists: true, mode: info.Mode().Perm(), content: content}
+	}
+	if s.files == nil {
+		s.files = make(map[string]snapshotFile, len(captured))
+	}
+	for path, f := range captured {
+		s.files[path] = f
+	}
+	return nil
+}
+
+// Restore returns every captured file to its captured state: files that
+// existed are atomically rewritten with their captured content and
+// permissions, and files that did not are removed. A failure to restore one
+// file does not stop the others from being restored; all failures are
+// returned together.
+func (s *Snapshot) Restore(fs afero.Fs) error {
+	paths := make([]string, 0, len(s.files))
+	for path := range s.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var errs *multierror.Error
+	for _, path := range paths {
+		f := s.files[path]
+		var err error
+		if f.exists {
+			err = writeFileAtomic(fs, path, f.content, f.mode)
+		} else if err = fs.Remove(path); os.IsNotExist(err) {
+			err = nil
+		}
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("unable to restore %s: %w", path, err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
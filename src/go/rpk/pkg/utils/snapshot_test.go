@@ -0,0 +1,54 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/etc/redpanda/redpanda.yaml", []byte("original"), 0o640))
+	require.NoError(t, afero.WriteFile(fs, "/etc/sysctl.conf", []byte("vm.swappiness=60\n"), 0o644))
+
+	var snap utils.Snapshot
+	require.NoError(t, snap.Capture(fs, "/etc/redpanda/redpanda.yaml", "/etc/redpanda/new.yaml"))
+	require.Error(t, snap.Capture(fs, "/etc/sysctl.conf", "/etc/redpanda"), "directories cannot be captured")
+
+	require.NoError(t, afero.WriteFile(fs, "/etc/redpanda/redpanda.yaml", []byte("edited"), 0o600))
+	require.NoError(t, snap.Capture(fs, "/etc/redpanda/redpanda.yaml", "/etc/sysctl.conf"))
+	require.NoError(t, afero.WriteFile(fs, "/etc/redpanda/new.yaml", []byte("new"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/etc/sysctl.conf", []byte("vm.swappiness=1\n"), 0o644))
+
+	require.NoError(t, snap.Restore(fs))
+
+	bs, err := afero.ReadFile(fs, "/etc/redpanda/redpanda.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "original", string(bs), "the first capture should win")
+	info, err := fs.Stat("/etc/redpanda/redpanda.yaml")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	bs, err = afero.ReadFile(fs, "/etc/sysctl.conf")
+	require.NoError(t, err)
+	require.Equal(t, "vm.swappiness=60\n", string(bs))
+
+	_, err = fs.Stat("/etc/redpanda/new.yaml")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// Restoring again is harmless.
+	require.NoError(t, snap.Restore(fs))
+	require.NoError(t, new(utils.Snapshot).Restore(fs))
+}
@@ -0,0 +1,19 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+//go:build !linux
+
+package utils
+
+import "github.com/spf13/afero"
+
+// exchangeFiles is only supported on Linux.
+func exchangeFiles(afero.Fs, string, string) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+//go:build linux
+
+package utils
+
+import (
+	"errors"
+	"os"
+
+	"github.com/spf13/afero"
+	"golang.org/x/sys/unix"
+)
+
+// exchangeFiles atomically exchanges a and b with renameat2(RENAME_EXCHANGE).
+// It returns false if the exchange is not supported, either because fs is not
+// backed by the OS or because the kernel or filesystem lacks the flag.
+func exchangeFiles(fs afero.Fs, a, b string) (bool, error) {
+	if _, ok := fs.(*afero.OsFs); !ok {
+		return false, nil
+	}
+	err := unix.Renameat2(unix.AT_FDCWD, a, unix.AT_FDCWD, b, unix.RENAME_EXCHANGE)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, unix.ENOSYS), errors.Is(err, unix.EINVAL), errors.Is(err, unix.ENOTSUP):
+		return false, nil
+	default:
+		return false, &os.LinkError{Op: "renameat2", Old: a, New: b, Err: err}
+	}
+}
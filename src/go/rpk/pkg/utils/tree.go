@@ -0,0 +1,287 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/spf13/afero"
+)
+
+// DirsEqual reports whether the trees rooted at a and b have the same
+// directories, files and symlinks, and returns the slash separated relative
+// paths that differ or exist in only one of them, sorted. Regular files are
+// compared by size and then, if the sizes match, by SHA-256. Symlinks are not
+// followed: two symlinks are equal if their targets are, which requires fs to
+// support reading links.
+func DirsEqual(fs afero.Fs, a, b string) (bool, []string, error) {
+	entriesA, err := treeEntries(fs, a)
+	if err != nil {
+		return false, nil, err
+	}
+	entriesB, err := treeEntries(fs, b)
+	if err != nil {
+		return false, nil, err
+	}
+
+	var diff []string
+	for rel, infoA := range entriesA {
+		infoB, ok := entriesB[rel]
+		if !ok {
+			diff = append(diff, rel)
+			continue
+		}
+		same, err := sameEntry(fs, filepath.Join(a, rel), infoA, filepath.Join(b, rel), infoB)
+		if err != nil {
+			return false, nil, err
+		}
+		if !same {
+			diff = append(diff, rel)
+		}
+	}
+	for rel := range entriesB {
+		if _, ok := entriesA[rel]; !ok {
+			diff = append(diff, rel)
+		}
+	}
+	sort.Strings(diff)
+	return len(diff) == 0, diff, nil
+}
+
+// DirHash returns the hex digest, computed with a hash from h, of the tree
+// rooted at root, for detecting whether anything under it changed. Entries are
+// hashed in sorted order of their relative paths, so the digest does not
+// depend on walk order, and every entry contributes its type and path along
+// with, for regular files, their content and, for symlinks, their target.
+// Each field is length-prefixed, so distinct trees cannot hash the same input.
+// Modes and modification times are not hashed.
+func DirHash(fs afero.Fs, root string, h func() hash.Hash) (string, error) {
+	entries, err := treeEntries(fs, root)
+	if err != nil {
+		return "", err
+	}
+	paths := make([]string, 0, len(entries))
+	for rel := range entries {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+
+	sum := h()
+	for _, rel := range paths {
+		info := entries[rel]
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		switch {
+		case info.IsDir():
+			fmt.Fprintf(sum, "d%d:%s", len(rel), rel)
+		case info.Mode().IsRegular():
+			fmt.Fprintf(sum, "f%d:%s%d:", len(rel), rel, info.Size())
+			if err := hashFileInto(fs, path, info.Size(), sum); err != nil {
+				return "", err
+			}
+		case info.Mode()&os.ModeSymlink != 0:
+			reader, ok := fs.(afero.LinkReader)
+			if !ok {
+				return "", fmt.Errorf("unable to hash symlink %s: filesystem does not support reading links", path)
+			}
+			target, err := reader.ReadlinkIfPossible(path)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(sum, "l%d:%s%d:%s", len(rel), rel, len(target), target)
+		default:
+			return "", fmt.Errorf("unable to hash %s: unsupported file type %s", path, info.Mode().Type())
+		}
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// hashFileInto writes the content of path, expected to be size bytes, to w. It
+// errors if the file changed size while being read, which would make the
+// length prefix written before it wrong.
+func hashFileInto(fs afero.Fs, path string, size int64, w io.Writer) error {
+	file, err := fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	n, err := io.Copy(w, io.LimitReader(file, size+1))
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	if n != size {
+		return fmt.Errorf("unable to hash %s: file changed size while reading", path)
+	}
+	return nil
+}
+
+// treeEntries returns every entry under root, without following symlinks,
+// keyed by its slash separated path relative to root. Root itself is not
+// included.
+func treeEntries(fs afero.Fs, root string) (map[string]os.FileInfo, error) {
+	entries := make(map[string]os.FileInfo)
+	err := afero.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." {
+			entries[filepath.ToSlash(rel)] = info
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to walk %s: %w", root, err)
+	}
+	return entries, nil
+}
+
+func sameEntry(fs afero.Fs, pathA string, infoA os.FileInfo, pathB string, infoB os.FileInfo) (bool, error) {
+	if infoA.Mode().Type() != infoB.Mode().Type() {
+		return false, nil
+	}
+	switch {
+	case infoA.IsDir():
+		return true, nil
+	case infoA.Mode()&os.ModeSymlink != 0:
+		reader, ok := fs.(afero.LinkReader)
+		if !ok {
+			return false, fmt.Errorf("unable to compare symlinks %s and %s: filesystem does not support reading links", pathA, pathB)
+		}
+		targetA, err := reader.ReadlinkIfPossible(pathA)
+		if err != nil {
+			return false, err
+		}
+		targetB, err := reader.ReadlinkIfPossible(pathB)
+		if err != nil {
+			return false, err
+		}
+		return targetA == targetB, nil
+	case infoA.Size() != infoB.Size():
+		return false, nil
+	}
+	sumA, err := fileDigest(fs, pathA, sha256.New())
+	if err != nil {
+		return false, err
+	}
+	sumB, err := fileDigest(fs, pathB, sha256.New())
+	if err != nil {
+		return false, err
+	}
+	return sumA == sumB, nil
+}
+
+// CopyDirConcurrent copies the tree rooted at srcDir to dstDir, keeping the
+// permissions of every directory and file. The directories are created first,
+// one at a time, and the files are then copied by a pool of concurrency
+// workers, defaulting to GOMAXPROCS if concurrency <= 0. Once any copy fails,
+// no further copies are started, and the errors of every failed copy are
+// returned together. Entries that are neither directories nor regular files,
+// such as symlinks, are an error, reported before anything is copied.
+func CopyDirConcurrent(fs afero.Fs, srcDir, dstDir string, concurrency int) error {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	entries, err := treeEntries(fs, srcDir)
+	if err != nil {
+		return err
+	}
+	var dirs, files []string
+	for rel, info := range entries {
+		switch {
+		case info.IsDir():
+			dirs = append(dirs, rel)
+		case info.Mode().IsRegular():
+			files = append(files, rel)
+		default:
+			return fmt.Errorf("unable to copy %s: %s is not a regular file or directory", srcDir, rel)
+		}
+	}
+	// Sorting puts every directory after its parent.
+	sort.Strings(dirs)
+	sort.Strings(files)
+
+	if err := fs.MkdirAll(dstDir, 0o755); err != nil {
+		return fmt.Errorf("unable to create %s: %v", dstDir, err)
+	}
+	for _, rel := range dirs {
+		dst := filepath.Join(dstDir, filepath.FromSlash(rel))
+		if err := fs.MkdirAll(dst, entries[rel].Mode().Perm()); err != nil {
+			return fmt.Errorf("unable to create %s: %v", dst, err)
+		}
+	}
+
+	var (
+		jobs     = make(chan string)
+		canceled = make(chan struct{})
+		once     sync.Once
+		mu       sync.Mutex
+		errs     *multierror.Error
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range jobs {
+				src := filepath.Join(srcDir, filepath.FromSlash(rel))
+				dst := filepath.Join(dstDir, filepath.FromSlash(rel))
+				if err := copyFileWithMode(fs, src, dst, entries[rel].Mode().Perm()); err != nil {
+					mu.Lock()
+					errs = multierror.Append(errs, err)
+					mu.Unlock()
+					once.Do(func() { close(canceled) })
+				}
+			}
+		}()
+	}
+feed:
+	for _, rel := range files {
+		select {
+		case jobs <- rel:
+		case <-canceled:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return errs.ErrorOrNil()
+}
+
+// copyFileWithMode streams src to a temporary file next to dst and renames it
+// over dst with perm, so a failed copy leaves dst untouched.
+func copyFileWithMode(fs afero.Fs, src, dst string, perm os.FileMode) error {
+	in, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createAtomicFile(fs, dst, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Abort()
+		return fmt.Errorf("unable to copy %s to %s: %v", src, dst, err)
+	}
+	return out.Commit()
+}
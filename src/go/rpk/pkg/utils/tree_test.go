@@ -0,0 +1,140 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirsEqual(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, root := range []string{"/a", "/b"} {
+		for name, content := range map[string]string{
+			"redpanda.yaml":   "redpanda: {}\n",
+			"certs/ca.crt":    "ca",
+			"certs/node.crt":  "node",
+			"data/empty.file": "",
+		} {
+			require.NoError(t, afero.WriteFile(fs, filepath.Join(root, name), []byte(content), 0o644))
+		}
+	}
+
+	equal, diff, err := utils.DirsEqual(fs, "/a", "/b")
+	require.NoError(t, err)
+	require.True(t, equal)
+	require.Empty(t, diff)
+
+	require.NoError(t, afero.WriteFile(fs, "/b/certs/ca.crt", []byte("CA"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/b/certs/node.crt", []byte("longer"), 0o644))
+	require.NoError(t, fs.Remove("/b/redpanda.yaml"))
+	require.NoError(t, afero.WriteFile(fs, "/b/extra", nil, 0o644))
+	require.NoError(t, fs.Remove("/b/data/empty.file"))
+	require.NoError(t, fs.Mkdir("/b/data/empty.file", 0o755))
+
+	equal, diff, err = utils.DirsEqual(fs, "/a", "/b")
+	require.NoError(t, err)
+	require.False(t, equal)
+	require.Equal(t, []string{"certs/ca.crt", "certs/node.crt", "data/empty.file", "extra", "redpanda.yaml"}, diff)
+
+	_, _, err = utils.DirsEqual(fs, "/a", "/missing")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDirsEqualSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	fs := afero.NewOsFs()
+	for name, target := range map[string]string{
+		"a/current": "v1",
+		"b/current": "v1",
+		"a/latest":  "v1",
+		"b/latest":  "v2",
+	} {
+		require.NoError(t, fs.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755))
+		require.NoError(t, os.Symlink(target, filepath.Join(dir, name)))
+	}
+
+	equal, diff, err := utils.DirsEqual(fs, filepath.Join(dir, "a"), filepath.Join(dir, "b"))
+	require.NoError(t, err)
+	require.False(t, equal)
+	require.Equal(t, []string{"latest"}, diff)
+}
+
+func TestCopyDirConcurrent(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("/src/certs/%02d/node.crt", i)
+		require.NoError(t, afero.WriteFile(fs, name, []byte(name), 0o644))
+	}
+	require.NoError(t, afero.WriteFile(fs, "/src/certs/node.key", []byte("key"), 0o600))
+	require.NoError(t, fs.MkdirAll("/src/empty", 0o700))
+
+	for _, concurrency := range []int{0, 1, 8} {
+		dst := fmt.Sprintf("/dst-%d", concurrency)
+		require.NoError(t, utils.CopyDirConcurrent(fs, "/src", dst, concurrency))
+
+		equal, diff, err := utils.DirsEqual(fs, "/src", dst)
+		require.NoError(t, err)
+		require.True(t, equal, "differing: %v", diff)
+
+		info, err := fs.Stat(dst + "/certs/node.key")
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+		info, err = fs.Stat(dst + "/empty")
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+	}
+
+	err := utils.CopyDirConcurrent(&failingOpenFs{fs, "/src/certs/07/node.crt"}, "/src", "/failed", 4)
+	require.ErrorIs(t, err, os.ErrPermission)
+}
+
+func TestDirHash(t *testing.T) {
+	build := func(files map[string]string) afero.Fs {
+		fs := afero.NewMemMapFs()
+		for name, content := range files {
+			require.NoError(t, afero.WriteFile(fs, filepath.Join("/conf", name), []byte(content), 0o644))
+		}
+		return fs
+	}
+	hashOf := func(fs afero.Fs) string {
+		sum, err := utils.DirHash(fs, "/conf", sha256.New)
+		require.NoError(t, err)
+		return sum
+	}
+	base := map[string]string{"redpanda.yaml": "a", "certs/ca.crt": "b", "certs/node.crt": "c"}
+	sum := hashOf(build(base))
+	require.Equal(t, sum, hashOf(build(base)), "equal trees should hash equally")
+
+	for name, files := range map[string]map[string]string{
+		"content":   {"redpanda.yaml": "A", "certs/ca.crt": "b", "certs/node.crt": "c"},
+		"name":      {"redpanda.yml": "a", "certs/ca.crt": "b", "certs/node.crt": "c"},
+		"moved":     {"redpanda.yaml": "a", "ca.crt": "b", "certs/node.crt": "c"},
+		"boundary":  {"redpanda.yaml": "a", "certs/ca.crt": "", "certs/node.crt": "bc"},
+		"extra":     {"redpanda.yaml": "a", "certs/ca.crt": "b", "certs/node.crt": "c", "x": ""},
+		"one fewer": {"redpanda.yaml": "a", "certs/ca.crt": "b"},
+	} {
+		require.NotEqual(t, sum, hashOf(build(files)), name)
+	}
+
+	fs := build(base)
+	require.NoError(t, fs.Mkdir("/conf/empty", 0o755))
+	require.NotEqual(t, sum, hashOf(fs), "directories should be hashed")
+
+	_, err := utils.DirHash(fs, "/missing", sha256.New)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/spf13/afero"
+)
+
+// atomicFile is a streaming counterpart to writeFileAtomic: writes go to a
+// temporary file next to path, which Commit renames into place and Abort
+// removes.
+type atomicFile struct {
+	fs   afero.Fs
+	path string
+	perm os.FileMode
+	temp afero.File
+	done bool
+}
+
+func createAtomicFile(fs afero.Fs, path string, perm os.FileMode) (*atomicFile, error) {
+	temp, err := createTempFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{fs: fs, path: path, perm: perm, temp: temp}, nil
+}
+
+func (a *atomicFile) Write(p []byte) (int, error) {
+	return a.temp.Write(p)
+}
+
+// Commit closes the temporary file and renames it to the target path. If any
+// step fails, the temporary file is removed.
+func (a *atomicFile) Commit() error {
+	if a.done {
+		return nil
+	}
+	a.done = true
+	if err := a.temp.Close(); err != nil {
+		a.fs.Remove(a.temp.Name())
+		return fmt.Errorf("unable to close temporary file for %q: %v", a.path, err)
+	}
+	if err := a.fs.Chmod(a.temp.Name(), a.perm); err != nil {
+		a.fs.Remove(a.temp.Name())
+		return fmt.Errorf("unable to chmod temporary file for %q: %v", a.path, err)
+	}
+	if err := a.fs.Rename(a.temp.Name(), a.path); err != nil {
+		a.fs.Remove(a.temp.Name())
+		return fmt.Errorf("unable to rename temporary file to %q: %v", a.path, err)
+	}
+	return nil
+}
+
+// Abort closes and removes the temporary file, leaving the target untouched.
+// It is a no-op after Commit.
+func (a *atomicFile) Abort() {
+	if a.done {
+		return
+	}
+	a.done = true
+	a.temp.Close()
+	a.fs.Remove(a.temp.Name())
+}
+
+type countingWriter struct {
+	f   *atomicFile
+	n   atomic.Int64
+	err error
+}
+
+// NewCountingWriter returns a writer that atomically writes path with mode,
+// along with a function reporting how many bytes have been written so far;
+// the function is safe to call concurrently with writes. Content is staged in
+// a temporary file that Close renames into place. If any write failed, Close
+// discards the temporary file and returns the write error.
+func NewCountingWriter(fs afero.Fs, path string, mode os.FileMode) (io.WriteCloser, func() int64, error) {
+	f, err := createAtomicFile(fs, path, mode)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := &countingWriter{f: f}
+	return w, w.n.Load, nil
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.n.Add(int64(n))
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *countingWriter) Close() error {
+	if w.err != nil {
+		w.f.Abort()
+		return fmt.Errorf("unable to write %s: %v", w.f.path, w.err)
+	}
+	return w.f.Commit()
+}
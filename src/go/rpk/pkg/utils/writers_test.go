@@ -0,0 +1,50 @@
+// Copyright 2023 Redpanda Data, Inc.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.md
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0
+
+package utils_test
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/redpanda-data/redpanda/src/go/rpk/pkg/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountingWriter(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := "/tmp/bundle.zip"
+
+	w, written, err := utils.NewCountingWriter(fs, path, 0o640)
+	require.NoError(t, err)
+	_, err = io.Copy(w, strings.NewReader("hello "))
+	require.NoError(t, err)
+	require.Equal(t, int64(6), written())
+	_, err = w.Write([]byte("world"))
+	require.NoError(t, err)
+	require.Equal(t, int64(11), written())
+
+	exists, err := afero.Exists(fs, path)
+	require.NoError(t, err)
+	require.False(t, exists, "file should not be visible before Close")
+
+	require.NoError(t, w.Close())
+	bs, err := afero.ReadFile(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(bs))
+	info, err := fs.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+	files, err := afero.ReadDir(fs, "/tmp")
+	require.NoError(t, err)
+	require.Len(t, files, 1, "temporary file was left behind")
+}